@@ -0,0 +1,81 @@
+package core
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Version overrides the version reported by [BuildInfo]. Set it at link
+// time:
+//
+//	go build -ldflags "-X github.com/sebatec-eu/config-mate/v2/core.Version=v1.2.3"
+var Version string
+
+// serviceVersionEnvVar overrides both Version and the embedded build info.
+const serviceVersionEnvVar = "SERVICE_VERSION"
+
+// fallbackVersion is reported when nothing better is known. It matches what
+// RequestLogger logged before versions were derived.
+const fallbackVersion = "latest"
+
+// Test seam: package-level indirection over debug.ReadBuildInfo.
+var readBuildInfo = debug.ReadBuildInfo
+
+// Build describes the running binary.
+type Build struct {
+	// Version is SERVICE_VERSION, else [Version], else the main module
+	// version, else the short VCS revision (with a "-dirty" suffix for
+	// modified trees), else "latest".
+	Version string
+
+	// Revision, Modified and Time come from the vcs.* build settings that
+	// `go build` embeds when building inside a repository.
+	Revision string
+	Modified bool
+	Time     time.Time
+
+	// GoVersion is the toolchain that built the binary.
+	GoVersion string
+}
+
+// BuildInfo returns the version and VCS details of the running binary,
+// derived from runtime/debug.ReadBuildInfo. Logging, health and metrics
+// output all report this version.
+func BuildInfo() Build {
+	var b Build
+	if bi, ok := readBuildInfo(); ok {
+		b.GoVersion = bi.GoVersion
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				b.Revision = s.Value
+			case "vcs.modified":
+				b.Modified = s.Value == "true"
+			case "vcs.time":
+				b.Time, _ = time.Parse(time.RFC3339, s.Value)
+			}
+		}
+		if v := bi.Main.Version; v != "" && v != "(devel)" {
+			b.Version = v
+		}
+	}
+
+	switch {
+	case getenv(serviceVersionEnvVar) != "":
+		b.Version = getenv(serviceVersionEnvVar)
+	case Version != "":
+		b.Version = Version
+	case b.Version != "":
+	case b.Revision != "":
+		b.Version = b.Revision
+		if len(b.Version) > 12 {
+			b.Version = b.Version[:12]
+		}
+		if b.Modified {
+			b.Version += "-dirty"
+		}
+	default:
+		b.Version = fallbackVersion
+	}
+	return b
+}
@@ -0,0 +1,64 @@
+package core
+
+import (
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+func TestBuildInfo(t *testing.T) {
+	settings := []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "0123456789abcdef0123"},
+		{Key: "vcs.modified", Value: "true"},
+		{Key: "vcs.time", Value: "2026-08-21T10:00:00Z"},
+	}
+	tests := []struct {
+		name        string
+		env, ldflag string
+		main        string
+		settings    []debug.BuildSetting
+		want        string
+	}{
+		{"env wins", "v9.9.9", "v1.0.0", "v0.1.0", settings, "v9.9.9"},
+		{"ldflags before module", "", "v1.0.0", "v0.1.0", settings, "v1.0.0"},
+		{"module version", "", "", "v0.1.0", settings, "v0.1.0"},
+		{"dirty revision for devel builds", "", "", "(devel)", settings, "0123456789ab-dirty"},
+		{"nothing known", "", "", "(devel)", nil, "latest"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(serviceVersionEnvVar, tc.env)
+			origVersion, origRead := Version, readBuildInfo
+			t.Cleanup(func() { Version, readBuildInfo = origVersion, origRead })
+			Version = tc.ldflag
+			readBuildInfo = func() (*debug.BuildInfo, bool) {
+				return &debug.BuildInfo{GoVersion: "go1.24.1", Main: debug.Module{Version: tc.main}, Settings: tc.settings}, true
+			}
+
+			b := BuildInfo()
+			if b.Version != tc.want {
+				t.Fatalf("Version: want %q, got %q", tc.want, b.Version)
+			}
+			if b.GoVersion != "go1.24.1" {
+				t.Errorf("GoVersion: got %q", b.GoVersion)
+			}
+			if tc.settings != nil {
+				if b.Revision != "0123456789abcdef0123" || !b.Modified || !b.Time.Equal(time.Date(2026, 8, 21, 10, 0, 0, 0, time.UTC)) {
+					t.Errorf("vcs details not parsed: %+v", b)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildInfoWithoutEmbeddedInfo(t *testing.T) {
+	t.Setenv(serviceVersionEnvVar, "")
+	orig := readBuildInfo
+	t.Cleanup(func() { readBuildInfo = orig })
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return nil, false }
+
+	if b := BuildInfo(); b.Version != "latest" {
+		t.Fatalf("want latest, got %q", b.Version)
+	}
+}
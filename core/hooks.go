@@ -0,0 +1,187 @@
+package core
+
+import (
+	"encoding"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+var (
+	int64Type           = reflect.TypeOf(int64(0))
+	fileModeType        = reflect.TypeOf(fs.FileMode(0))
+	urlType             = reflect.TypeOf(url.URL{})
+	locationType        = reflect.TypeOf(time.Location{})
+	bytesType           = reflect.TypeOf([]byte{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+var byteSizeRe = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-zA-Z]*)$`)
+
+// byteSizeUnits are the lower-cased units of StringToByteSizeHookFunc.
+var byteSizeUnits = map[string]float64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kib": 1 << 10, "kb": 1e3,
+	"m": 1 << 20, "mib": 1 << 20, "mb": 1e6,
+	"g": 1 << 30, "gib": 1 << 30, "gb": 1e9,
+	"t": 1 << 40, "tib": 1 << 40, "tb": 1e12,
+	"p": 1 << 50, "pib": 1 << 50, "pb": 1e15,
+}
+
+// StringToByteSizeHookFunc returns a mapstructure decode hook that turns
+// byte sizes with a unit, such as "10MiB", "1.5 GB" or "64k", into int64
+// fields. KiB, MiB, GiB, TiB and PiB and the short K, M, G, T and P are
+// powers of 1024; kB, MB, GB, TB and PB are powers of 1000. Units are case
+// insensitive. Strings without a unit, e.g. "512" or "0x10", are left to
+// the decoder, so they decode as they did without the hook.
+func StringToByteSizeHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != int64Type {
+			return data, nil
+		}
+		m := byteSizeRe.FindStringSubmatch(strings.TrimSpace(data.(string)))
+		if m == nil || m[2] == "" {
+			return data, nil
+		}
+		return ParseByteSize(data.(string))
+	}
+}
+
+// ParseByteSize parses a byte size as StringToByteSizeHookFunc does. A
+// plain integer is taken as bytes, in any base strconv.ParseInt accepts
+// with base 0.
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return n, nil
+	}
+	m := byteSizeRe.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	unit, ok := byteSizeUnits[strings.ToLower(m[2])]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte size %q: unknown unit %q", s, m[2])
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	size := n * unit
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("byte size %q is too large", s)
+	}
+	if size != math.Trunc(size) {
+		return 0, fmt.Errorf("byte size %q is not a whole number of bytes", s)
+	}
+	return int64(size), nil
+}
+
+// StringToURLHookFunc returns a mapstructure decode hook that parses
+// strings into url.URL and *url.URL fields with url.Parse.
+func StringToURLHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != urlType && t != reflect.PointerTo(urlType) {
+			return data, nil
+		}
+		u, err := url.Parse(data.(string))
+		if err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+}
+
+// StringToTimeLocationHookFunc returns a mapstructure decode hook that
+// loads IANA time zone names such as "Europe/Berlin", "UTC" or "Local"
+// into time.Location and *time.Location fields.
+func StringToTimeLocationHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != locationType && t != reflect.PointerTo(locationType) {
+			return data, nil
+		}
+		loc, err := time.LoadLocation(data.(string))
+		if err != nil {
+			return nil, err
+		}
+		// The decoder copies the Location; make sure time.Local is loaded
+		// before, as it is filled in lazily.
+		_ = loc.String()
+		return loc, nil
+	}
+}
+
+// StringToFileModeHookFunc returns a mapstructure decode hook that parses
+// permissions into fs.FileMode fields as strconv.ParseUint does with base
+// 0, so "0640" and "0o640" are octal while "640" is decimal, as without the
+// hook. Other strings fail with a hint to write the mode in octal.
+func StringToFileModeHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != fileModeType {
+			return data, nil
+		}
+		s := strings.TrimSpace(data.(string))
+		if s == "" {
+			return fs.FileMode(0), nil
+		}
+		mode, err := strconv.ParseUint(s, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file mode %q: want octal such as 0640", data)
+		}
+		return fs.FileMode(mode), nil
+	}
+}
+
+// HexStringToBytesHookFunc returns a mapstructure decode hook that decodes
+// hex strings into []byte fields. It is not among the defaults of
+// ReadInConfig, which decode []byte as base64; pass it in place of
+// Base64StringToBytesHookFunc.
+func HexStringToBytesHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || t != bytesType {
+			return data, nil
+		}
+		return hex.DecodeString(data.(string))
+	}
+}
+
+// TextUnmarshalerHookFunc returns a mapstructure decode hook that decodes
+// strings into any type whose pointer implements encoding.TextUnmarshaler,
+// among them net.IP, netip.Addr, netip.Prefix, *regexp.Regexp, slog.Level
+// and time.Time (RFC 3339). An empty string is the zero value. For types
+// with a numeric underlying type, such as slog.Level, a number that
+// UnmarshalText rejects decodes as a number, as it did without the hook.
+func TextUnmarshalerHookFunc() mapstructure.DecodeHookFuncType {
+	return func(f, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String || !reflect.PointerTo(t).Implements(textUnmarshalerType) {
+			return data, nil
+		}
+		s := data.(string)
+		if s == "" {
+			return reflect.Zero(t).Interface(), nil
+		}
+		v := reflect.New(t)
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			if isNumeric(t.Kind()) {
+				if _, perr := strconv.ParseFloat(s, 64); perr == nil {
+					return data, nil
+				}
+			}
+			return nil, err
+		}
+		return v.Elem().Interface(), nil
+	}
+}
+
+func isNumeric(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
@@ -0,0 +1,258 @@
+package core
+
+import (
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+var stringType = reflect.TypeOf("")
+
+func TestStringToByteSizeHookFunc(t *testing.T) {
+	for in, want := range map[string]int64{
+		"64k":    64 << 10,
+		"10MiB":  10 << 20,
+		"10mib":  10 << 20,
+		"1.5 GB": 1_500_000_000,
+		"2kB":    2000,
+		"1G":     1 << 30,
+		"3 b":    3,
+	} {
+		got, err := runHook(StringToByteSizeHookFunc(), stringType, int64Type, in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: expected %d, got %v", in, want, got)
+		}
+	}
+
+	for _, in := range []string{"10 apples", "9000PiB", "1.5B"} {
+		if _, err := runHook(StringToByteSizeHookFunc(), stringType, int64Type, in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+
+	t.Run("strings without a unit are left to the decoder", func(t *testing.T) {
+		for _, in := range []string{"512", "-1", "", "0x10", "0o17", "1_000", "1.5", "MiB", "-1MiB", "1.5.5MB"} {
+			got, err := runHook(StringToByteSizeHookFunc(), stringType, int64Type, in)
+			if err != nil || got != in {
+				t.Errorf("%q: expected pass-through, got %v, %v", in, got, err)
+			}
+		}
+	})
+
+	t.Run("ParseByteSize", func(t *testing.T) {
+		for in, want := range map[string]int64{"512": 512, "0x10": 16, "1_000": 1000, "2 KiB": 2048} {
+			if got, err := ParseByteSize(in); err != nil || got != want {
+				t.Errorf("%q: expected %d, got %d, %v", in, want, got, err)
+			}
+		}
+		if _, err := ParseByteSize("1.5"); err == nil {
+			t.Error("expected an error for a fraction of a byte")
+		}
+	})
+
+	t.Run("other targets pass through", func(t *testing.T) {
+		got, err := runHook(StringToByteSizeHookFunc(), stringType, reflect.TypeOf(time.Duration(0)), "10MiB")
+		if err != nil || got != "10MiB" {
+			t.Errorf("expected pass-through, got %v, %v", got, err)
+		}
+	})
+}
+
+func TestStringToURLHookFunc(t *testing.T) {
+	for _, to := range []reflect.Type{urlType, reflect.PointerTo(urlType)} {
+		got, err := runHook(StringToURLHookFunc(), stringType, to, "https://example.com:8443/api?x=1")
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", to, err)
+		}
+		u, ok := got.(*url.URL)
+		if !ok {
+			t.Fatalf("%v: expected *url.URL, got %T", to, got)
+		}
+		if u.Host != "example.com:8443" || u.Path != "/api" {
+			t.Errorf("%v: unexpected URL %v", to, u)
+		}
+	}
+
+	if _, err := runHook(StringToURLHookFunc(), stringType, urlType, "http://[::1"); err == nil {
+		t.Error("expected an error for an invalid URL")
+	}
+}
+
+func TestStringToTimeLocationHookFunc(t *testing.T) {
+	for _, name := range []string{"UTC", "Europe/Berlin", "Local"} {
+		got, err := runHook(StringToTimeLocationHookFunc(), stringType, reflect.PointerTo(locationType), name)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if loc := got.(*time.Location); loc.String() != name {
+			t.Errorf("expected %s, got %s", name, loc)
+		}
+	}
+
+	if _, err := runHook(StringToTimeLocationHookFunc(), stringType, locationType, "Mars/Olympus"); err == nil {
+		t.Error("expected an error for an unknown zone")
+	}
+}
+
+func TestStringToFileModeHookFunc(t *testing.T) {
+	for in, want := range map[string]fs.FileMode{
+		"0640":  0o640,
+		"0o755": 0o755,
+		"640":   640, // decimal, as without the hook
+		"0x1a4": 0o644,
+		"0":     0,
+		"":      0,
+	} {
+		got, err := runHook(StringToFileModeHookFunc(), stringType, fileModeType, in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: expected %v, got %v", in, want, got)
+		}
+	}
+
+	for _, in := range []string{"0968", "rw-r-----"} {
+		if _, err := runHook(StringToFileModeHookFunc(), stringType, fileModeType, in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestHexStringToBytesHookFunc(t *testing.T) {
+	got, err := runHook(HexStringToBytesHookFunc(), stringType, bytesType, "00ff10")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, []byte{0x00, 0xff, 0x10}) {
+		t.Errorf("expected 00ff10, got %x", got)
+	}
+
+	if _, err := runHook(HexStringToBytesHookFunc(), stringType, bytesType, "xyz"); err == nil {
+		t.Error("expected an error for invalid hex")
+	}
+}
+
+func TestTextUnmarshalerHookFunc(t *testing.T) {
+	hook := TextUnmarshalerHookFunc()
+
+	tests := []struct {
+		in   string
+		to   reflect.Type
+		want any
+	}{
+		{"192.0.2.1", reflect.TypeOf(net.IP{}), net.ParseIP("192.0.2.1")},
+		{"10.0.0.0/8", reflect.TypeOf(netip.Prefix{}), netip.MustParsePrefix("10.0.0.0/8")},
+		{"::1", reflect.TypeOf(netip.Addr{}), netip.MustParseAddr("::1")},
+		{"WARN", reflect.TypeOf(slog.LevelInfo), slog.LevelWarn},
+		{"debug+2", reflect.TypeOf(slog.LevelInfo), slog.LevelDebug + 2},
+		{"4", reflect.TypeOf(slog.LevelInfo), "4"}, // decoded as a number
+		{"2024-05-01T12:00:00Z", reflect.TypeOf(time.Time{}), time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{"", reflect.TypeOf(netip.Prefix{}), netip.Prefix{}},
+		{"plain", stringType, "plain"},
+	}
+	for _, tt := range tests {
+		got, err := runHook(hook, stringType, tt.to, tt.in)
+		if err != nil {
+			t.Errorf("%q to %v: unexpected error: %v", tt.in, tt.to, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q to %v: expected %#v, got %#v", tt.in, tt.to, tt.want, got)
+		}
+	}
+
+	t.Run("regexp", func(t *testing.T) {
+		got, err := runHook(hook, stringType, reflect.TypeOf(regexp.Regexp{}), "^a+$")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		re := got.(regexp.Regexp)
+		if !re.MatchString("aaa") || re.MatchString("b") {
+			t.Errorf("unexpected regexp %v", &re)
+		}
+	})
+
+	for _, tt := range []struct {
+		in string
+		to reflect.Type
+	}{
+		{"not-an-ip", reflect.TypeOf(netip.Addr{})},
+		{"LOUD", reflect.TypeOf(slog.LevelInfo)},
+		{"(", reflect.TypeOf(regexp.Regexp{})},
+	} {
+		if _, err := runHook(hook, stringType, tt.to, tt.in); err == nil {
+			t.Errorf("%q to %v: expected an error", tt.in, tt.to)
+		}
+	}
+}
+
+// TestDecodeHooks decodes a struct through mapstructure with the hooks
+// composed as ReadInConfig does, pointers and slices included.
+func TestDecodeHooks(t *testing.T) {
+	var cfg struct {
+		MaxBody  int64
+		Mode     fs.FileMode
+		Upstream *url.URL
+		Zone     *time.Location
+		Trusted  []netip.Prefix
+		Pattern  *regexp.Regexp
+		Level    slog.Level
+	}
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			StringToByteSizeHookFunc(),
+			StringToURLHookFunc(),
+			StringToTimeLocationHookFunc(),
+			StringToFileModeHookFunc(),
+			TextUnmarshalerHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		Result:           &cfg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dec.Decode(map[string]any{
+		"maxbody":  "10MiB",
+		"mode":     "0640",
+		"upstream": "http://backend:8080",
+		"zone":     "Europe/Berlin",
+		"trusted":  "10.0.0.0/8,192.168.0.0/16",
+		"pattern":  "^/api/",
+		"level":    "4",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.MaxBody != 10<<20 || cfg.Mode != 0o640 || cfg.Level != slog.LevelWarn {
+		t.Errorf("unexpected values: %+v", cfg)
+	}
+	if cfg.Upstream == nil || cfg.Upstream.Host != "backend:8080" {
+		t.Errorf("unexpected upstream %v", cfg.Upstream)
+	}
+	if cfg.Zone == nil || cfg.Zone.String() != "Europe/Berlin" {
+		t.Errorf("unexpected zone %v", cfg.Zone)
+	}
+	if len(cfg.Trusted) != 2 || cfg.Trusted[1] != netip.MustParsePrefix("192.168.0.0/16") {
+		t.Errorf("unexpected trusted %v", cfg.Trusted)
+	}
+	if cfg.Pattern == nil || !cfg.Pattern.MatchString("/api/x") {
+		t.Errorf("unexpected pattern %v", cfg.Pattern)
+	}
+}
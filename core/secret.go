@@ -0,0 +1,135 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/mapstructure"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	secretFilePrefix = "file:"
+	secretEnvPrefix  = "env:"
+	secretEncPrefix  = "enc:"
+
+	secretNonceSize = 24
+)
+
+// SecretRefHookFunc returns a mapstructure decode hook that replaces string
+// values referring to a secret with the secret itself:
+//
+//   - file:/abs/path — the contents of the file, without trailing newlines;
+//     only absolute paths count, so "file:app.db" stays a plain value
+//   - env:NAME — the value of the environment variable NAME, which must be
+//     set
+//   - enc:… — a value sealed with [EncryptSecret] using the key in keyFile
+//     (see [ReadSecretKey])
+//
+// Other values pass through unchanged. The result is a string, so the hook
+// goes first in a chain, before hooks such as Base64StringToBytesHookFunc
+// or StringToTimeDurationHookFunc that convert it further. keyFile is read
+// on the first enc: value only; with keyFile "" enc: values fail.
+//
+// In a hook chain it applies to every string value, which turns a DSN such
+// as "file:/srv/app.db" into the contents of that file. server.ReadInConfig
+// therefore does not put it in its chain and resolves only the fields
+// tagged `secret:"true"`.
+func SecretRefHookFunc(keyFile string) mapstructure.DecodeHookFuncType {
+	var (
+		once   sync.Once
+		key    *[32]byte
+		keyErr error
+	)
+	return func(f, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() != reflect.String {
+			return data, nil
+		}
+		s, _ := data.(string)
+		switch {
+		case strings.HasPrefix(s, secretFilePrefix+"/"):
+			path := strings.TrimPrefix(s, secretFilePrefix)
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read secret: %w", err)
+			}
+			return strings.TrimRight(string(b), "\r\n"), nil
+		case strings.HasPrefix(s, secretEnvPrefix):
+			name := strings.TrimPrefix(s, secretEnvPrefix)
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				return nil, fmt.Errorf("secret env var %s is not set", name)
+			}
+			return v, nil
+		case strings.HasPrefix(s, secretEncPrefix):
+			once.Do(func() {
+				if keyFile == "" {
+					keyErr = errors.New("no secret key file configured")
+					return
+				}
+				key, keyErr = ReadSecretKey(keyFile)
+			})
+			if keyErr != nil {
+				return nil, fmt.Errorf("cannot decrypt secret: %w", keyErr)
+			}
+			b, err := DecryptSecret(key, s)
+			if err != nil {
+				return nil, err
+			}
+			return string(b), nil
+		}
+		return data, nil
+	}
+}
+
+// ReadSecretKey reads a 32-byte secretbox key stored base64-encoded in
+// path, e.g. created with
+//
+//	head -c 32 /dev/urandom | base64 > myapp.key
+func ReadSecretKey(path string) (*[32]byte, error) {
+	b, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("%s: want a base64-encoded 32-byte key", path)
+	}
+	key := new([32]byte)
+	copy(key[:], raw)
+	return key, nil
+}
+
+// EncryptSecret seals plaintext with NaCl secretbox under key and returns
+// it as "enc:" followed by the base64 of a random nonce and the sealed box,
+// ready to be pasted into a config file.
+func EncryptSecret(key *[32]byte, plaintext []byte) (string, error) {
+	var nonce [secretNonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", err
+	}
+	box := secretbox.Seal(nonce[:], plaintext, &nonce, key)
+	return secretEncPrefix + base64.StdEncoding.EncodeToString(box), nil
+}
+
+// DecryptSecret opens a value made by [EncryptSecret].
+func DecryptSecret(key *[32]byte, value string) ([]byte, error) {
+	box, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretEncPrefix))
+	if err != nil || len(box) < secretNonceSize+secretbox.Overhead {
+		return nil, errors.New("cannot decrypt secret: malformed enc: value")
+	}
+	var nonce [secretNonceSize]byte
+	copy(nonce[:], box)
+	plain, ok := secretbox.Open(nil, box[secretNonceSize:], &nonce, key)
+	if !ok {
+		return nil, errors.New("cannot decrypt secret: wrong key or corrupted value")
+	}
+	return plain, nil
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSecretRefHookFunc(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "db.pass")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "myapp.key")
+	keyText := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	if err := os.WriteFile(keyFile, []byte(keyText+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ReadSecretKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := EncryptSecret(key, []byte("from-enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_PASSWORD", "from-env")
+
+	hook := SecretRefHookFunc(keyFile)
+	str := reflect.TypeOf("")
+	for in, want := range map[string]string{
+		"file:" + secretFile: "from-file",
+		"env:DB_PASSWORD":    "from-env",
+		sealed:               "from-enc",
+		"file:app.db":        "file:app.db",
+		"plain":              "plain",
+	} {
+		got, err := runHook(hook, str, str, in)
+		if err != nil {
+			t.Errorf("%s: %v", in, err)
+		} else if got != want {
+			t.Errorf("%s: want %q, got %q", in, want, got)
+		}
+	}
+
+	for _, in := range []string{
+		"file:" + filepath.Join(dir, "missing"),
+		"env:UNSET_SECRET_FOR_TEST",
+		"enc:" + base64.StdEncoding.EncodeToString(make([]byte, 64)),
+		"enc:not base64",
+	} {
+		if _, err := runHook(hook, str, str, in); err == nil {
+			t.Errorf("%s: want error", in)
+		}
+	}
+	if _, err := runHook(SecretRefHookFunc(""), str, str, sealed); err == nil {
+		t.Error("enc: without key file: want error")
+	}
+}
+
+func TestReadSecretKeyRejectsShortKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "short.key")
+	if err := os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString([]byte("short"))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSecretKey(keyFile); err == nil {
+		t.Fatal("want error for a 5-byte key")
+	}
+}
@@ -0,0 +1,22 @@
+package health
+
+import (
+	"context"
+	"fmt"
+)
+
+// DiskSpaceCheck fails when the file system holding dir has less than
+// minFree bytes available to unprivileged users. Use it on the data
+// directory, e.g. the DataDir() of hostsharing.DomainByExecutable.
+func DiskSpaceCheck(dir string, minFree uint64) Check {
+	return func(ctx context.Context) error {
+		free, err := diskFree(dir)
+		if err != nil {
+			return fmt.Errorf("cannot stat %s: %w", dir, err)
+		}
+		if free < minFree {
+			return fmt.Errorf("%s: %d bytes free, want at least %d", dir, free, minFree)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,207 @@
+// Package health provides liveness and readiness endpoints backed by a
+// registry of named checks.
+//
+// A typical setup mounts the handlers on the admin listener and flips
+// readiness to failing as soon as the server starts draining:
+//
+//	reg := health.New()
+//	reg.AddReadinessCheck("database", health.DatabaseCheck(db))
+//	reg.AddReadinessCheck("disk", health.DiskSpaceCheck(dom.DataDir(), 512<<20))
+//
+//	admin := server.NewAdminMux()
+//	reg.Register(admin)
+//	srv := &server.Server{Handler: router, HTTPAddr: ":9000", AdminAddr: "127.0.0.1:9100", AdminHandler: admin}
+//	err := srv.ListenAndServe(ctx, server.WithOnShutdown(reg.Drain))
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sebatec-eu/config-mate/v2/core"
+	"gorm.io/gorm"
+)
+
+// DefaultTimeout bounds a single check run by the handlers.
+const DefaultTimeout = 5 * time.Second
+
+// Check reports a problem by returning an error. It must honour ctx.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Registry holds the liveness and readiness checks of a process. The zero
+// value is not usable; create one with [New].
+type Registry struct {
+	// Timeout bounds each check; zero means [DefaultTimeout].
+	Timeout time.Duration
+
+	mu        sync.RWMutex
+	liveness  []namedCheck
+	readiness []namedCheck
+	draining  atomic.Bool
+}
+
+// New returns an empty Registry.
+func New() *Registry {
+	return &Registry{}
+}
+
+// AddLivenessCheck registers a check for /healthz. Keep liveness checks to
+// conditions a restart would fix; a failing dependency belongs in
+// readiness.
+func (r *Registry) AddLivenessCheck(name string, c Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.liveness = append(r.liveness, namedCheck{name, c})
+}
+
+// AddReadinessCheck registers a check for /readyz.
+func (r *Registry) AddReadinessCheck(name string, c Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readiness = append(r.readiness, namedCheck{name, c})
+}
+
+// Drain makes readiness fail from now on, so load balancers stop sending
+// traffic while in-flight requests finish. Pass it to
+// server.WithOnShutdown.
+func (r *Registry) Drain() {
+	r.draining.Store(true)
+}
+
+// Draining reports whether [Registry.Drain] was called.
+func (r *Registry) Draining() bool {
+	return r.draining.Load()
+}
+
+// Register mounts [Registry.LivenessHandler] on /healthz and
+// [Registry.ReadinessHandler] on /readyz.
+func (r *Registry) Register(mux interface {
+	Handle(pattern string, handler http.Handler)
+}) {
+	mux.Handle("/healthz", r.LivenessHandler())
+	mux.Handle("/readyz", r.ReadinessHandler())
+}
+
+// LivenessHandler runs the liveness checks and answers 200 or 503 with a
+// [Report] as JSON.
+func (r *Registry) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.run(req.Context(), r.checks(false), false))
+	})
+}
+
+// ReadinessHandler runs the readiness checks and answers 200 or 503 with a
+// [Report] as JSON. While draining it always answers 503.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		writeReport(w, r.run(req.Context(), r.checks(true), r.Draining()))
+	})
+}
+
+func (r *Registry) checks(readiness bool) []namedCheck {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if readiness {
+		return append([]namedCheck(nil), r.readiness...)
+	}
+	return append([]namedCheck(nil), r.liveness...)
+}
+
+// Status values used in a [Report].
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusDraining = "draining"
+)
+
+// Report is the JSON body served by the handlers. Version is
+// core.BuildInfo().Version.
+type Report struct {
+	Status  string                 `json:"status"`
+	Version string                 `json:"version"`
+	Checks  map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+}
+
+// run executes the checks concurrently, each under its own timeout.
+func (r *Registry) run(ctx context.Context, checks []namedCheck, draining bool) Report {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	rep := Report{
+		Status:  StatusOK,
+		Version: core.BuildInfo().Version,
+		Checks:  make(map[string]CheckResult, len(checks)),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			start := time.Now()
+			err := c.check(ctx)
+			res := CheckResult{Status: StatusOK, Latency: time.Since(start).String()}
+			if err != nil {
+				res.Status, res.Error = StatusFail, err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			rep.Checks[c.name] = res
+			if err != nil {
+				rep.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+
+	if draining {
+		rep.Status = StatusDraining
+	}
+	return rep
+}
+
+func writeReport(w http.ResponseWriter, rep Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if rep.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(rep)
+}
+
+// DatabaseCheck pings the sql.DB underneath a connection returned by
+// database.Open.
+func DatabaseCheck(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		if db == nil {
+			return errors.New("no database connection")
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
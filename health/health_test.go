@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	reg := New()
+	reg.AddReadinessCheck("ok", func(ctx context.Context) error { return nil })
+
+	code, rep := get(t, reg.ReadinessHandler())
+	if code != http.StatusOK || rep.Status != StatusOK {
+		t.Fatalf("want 200/ok, got %d/%s", code, rep.Status)
+	}
+	if res := rep.Checks["ok"]; res.Status != StatusOK || res.Latency == "" {
+		t.Fatalf("unexpected check result: %+v", res)
+	}
+
+	reg.AddReadinessCheck("broken", func(ctx context.Context) error { return errors.New("boom") })
+	code, rep = get(t, reg.ReadinessHandler())
+	if code != http.StatusServiceUnavailable || rep.Status != StatusFail {
+		t.Fatalf("want 503/fail, got %d/%s", code, rep.Status)
+	}
+	if res := rep.Checks["broken"]; res.Status != StatusFail || res.Error != "boom" {
+		t.Fatalf("unexpected check result: %+v", res)
+	}
+}
+
+// Draining fails readiness but leaves liveness alone.
+func TestDrain(t *testing.T) {
+	reg := New()
+	reg.Drain()
+
+	if code, rep := get(t, reg.ReadinessHandler()); code != http.StatusServiceUnavailable || rep.Status != StatusDraining {
+		t.Fatalf("readiness: want 503/draining, got %d/%s", code, rep.Status)
+	}
+	if code, rep := get(t, reg.LivenessHandler()); code != http.StatusOK || rep.Status != StatusOK {
+		t.Fatalf("liveness: want 200/ok, got %d/%s", code, rep.Status)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	reg := New()
+	reg.Timeout = 10 * time.Millisecond
+	reg.AddLivenessCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if code, rep := get(t, reg.LivenessHandler()); code != http.StatusServiceUnavailable || rep.Checks["slow"].Error == "" {
+		t.Fatalf("want timed-out check, got %d %+v", code, rep)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	mux := http.NewServeMux()
+	New().Register(mux)
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: want 200, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestDatabaseCheck(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := DatabaseCheck(db)
+	if err := check(context.Background()); err != nil {
+		t.Fatalf("want ping ok, got %v", err)
+	}
+
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	if err := check(context.Background()); err == nil {
+		t.Fatal("want error for a closed database")
+	}
+	if err := DatabaseCheck(nil)(context.Background()); err == nil {
+		t.Fatal("want error for a nil database")
+	}
+}
+
+func TestDiskSpaceCheck(t *testing.T) {
+	dir := t.TempDir()
+	if err := DiskSpaceCheck(dir, 0)(context.Background()); err != nil {
+		t.Fatalf("want ok, got %v", err)
+	}
+	if err := DiskSpaceCheck(dir, 1<<62)(context.Background()); err == nil {
+		t.Fatal("want error for an impossible minimum")
+	}
+	if err := DiskSpaceCheck(dir+"/missing", 0)(context.Background()); err == nil {
+		t.Fatal("want error for a missing directory")
+	}
+}
+
+func get(t *testing.T, h http.Handler) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type: want application/json, got %q", ct)
+	}
+	var rep Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &rep); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, rep
+}
+
+func TestReportVersion(t *testing.T) {
+	t.Setenv("SERVICE_VERSION", "v1.2.3")
+	if _, rep := get(t, New().LivenessHandler()); rep.Version != "v1.2.3" {
+		t.Fatalf("want version v1.2.3, got %q", rep.Version)
+	}
+}
@@ -0,0 +1,11 @@
+package metrics
+
+import "github.com/sebatec-eu/config-mate/v2/core"
+
+// RegisterBuildInfo registers the build_info gauge, always 1, labelled
+// with version, revision and Go version from core.BuildInfo.
+func RegisterBuildInfo(reg *Registry) {
+	b := core.BuildInfo()
+	reg.NewGauge("build_info", "Build information of the running binary.", "version", "revision", "goversion").
+		Set(1, b.Version, b.Revision, b.GoVersion)
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const gormStartKey = "metrics:start"
+
+// InstrumentDB registers gorm callbacks on db (e.g. from database.Open)
+// that record, per operation (create, query, update, delete, row, raw) and
+// table:
+//
+//   - db_query_duration_seconds (histogram)
+//   - db_query_errors_total (counter; gorm.ErrRecordNotFound is not an error)
+//
+// It registers these families on reg, so call it once per Registry.
+func InstrumentDB(db *gorm.DB, reg *Registry) error {
+	duration := reg.NewHistogram("db_query_duration_seconds", "Duration of database queries in seconds.", nil, "operation", "table")
+	failures := reg.NewCounter("db_query_errors_total", "Number of failed database queries.", "operation", "table")
+
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(gormStartKey, time.Now())
+	}
+	after := func(op string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			v, ok := tx.InstanceGet(gormStartKey)
+			start, _ := v.(time.Time)
+			if !ok || start.IsZero() {
+				return
+			}
+			table := tx.Statement.Table
+			duration.Observe(time.Since(start).Seconds(), op, table)
+			if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+				failures.Inc(op, table)
+			}
+		}
+	}
+
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("metrics:before_create", before),
+		cb.Create().After("gorm:create").Register("metrics:after_create", after("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", before),
+		cb.Query().After("gorm:query").Register("metrics:after_query", after("query")),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", before),
+		cb.Update().After("gorm:update").Register("metrics:after_update", after("update")),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", before),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete")),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", before),
+		cb.Row().After("gorm:row").Register("metrics:after_row", after("row")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", before),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", after("raw")),
+	)
+}
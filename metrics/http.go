@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// unmatchedRoute labels requests that no chi route matched, so raw paths
+// never end up as label values.
+const unmatchedRoute = "unmatched"
+
+// Middleware returns an HTTP middleware that records, per method, chi route
+// pattern and status class ("2xx", "4xx", …):
+//
+//   - http_requests_total (counter)
+//   - http_request_duration_seconds (histogram)
+//
+// and http_requests_in_flight (gauge). Use it inside a chi router so the
+// route pattern is known. It registers these families on reg, so call it
+// once per Registry.
+func Middleware(reg *Registry) func(http.Handler) http.Handler {
+	total := reg.NewCounter("http_requests_total", "Number of HTTP requests served.", "method", "route", "status")
+	duration := reg.NewHistogram("http_request_duration_seconds", "Duration of HTTP requests in seconds.", nil, "method", "route", "status")
+	inFlight := reg.NewGauge("http_requests_in_flight", "Number of HTTP requests currently being served.")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inFlight.Add(1)
+			defer inFlight.Add(-1)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			start := time.Now()
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				labels := []string{r.Method, routePattern(r), statusClass(status)}
+				total.Inc(labels...)
+				duration.Observe(time.Since(start).Seconds(), labels...)
+			}()
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
+
+// routePattern reads the pattern chi matched; chi fills the route context
+// in place while routing, so it is complete once the handler returned.
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if p := rctx.RoutePattern(); p != "" {
+			return p
+		}
+	}
+	return unmatchedRoute
+}
+
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+)
+
+func TestExpositionFormat(t *testing.T) {
+	reg := NewRegistry()
+	c := reg.NewCounter("jobs_total", "Jobs done.\nSecond line.", "queue")
+	g := reg.NewGauge("temperature", "Current temperature.")
+	h := reg.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1}, "op")
+
+	c.Inc(`a"b`)
+	c.Add(2, `a"b`)
+	g.Set(-1.5)
+	h.Observe(0.05, "read")
+	h.Observe(0.5, "read")
+	h.Observe(5, "read")
+
+	want := `# HELP jobs_total Jobs done.\nSecond line.
+# TYPE jobs_total counter
+jobs_total{queue="a\"b"} 3
+# HELP temperature Current temperature.
+# TYPE temperature gauge
+temperature -1.5
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{op="read",le="0.1"} 1
+latency_seconds_bucket{op="read",le="1"} 2
+latency_seconds_bucket{op="read",le="+Inf"} 3
+latency_seconds_sum{op="read"} 5.55
+latency_seconds_count{op="read"} 3
+`
+	if got := scrape(t, reg); got != want {
+		t.Fatalf("exposition mismatch\n--- got\n%s\n--- want\n%s", got, want)
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	reg := NewRegistry()
+	reg.NewCounter("x", "")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("want panic for duplicate name")
+		}
+	}()
+	reg.NewGauge("x", "")
+}
+
+func TestMiddlewareUsesRoutePattern(t *testing.T) {
+	reg := NewRegistry()
+	r := chi.NewRouter()
+	r.Use(Middleware(reg))
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	r.Get("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/fail", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	out := scrape(t, reg)
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/users/{id}",status="2xx"} 2`,
+		`http_requests_total{method="GET",route="/fail",status="5xx"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="4xx"} 1`,
+		`http_request_duration_seconds_count{method="GET",route="/users/{id}",status="2xx"} 2`,
+		`http_requests_in_flight 0`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "/users/1") {
+		t.Error("raw paths must not become label values")
+	}
+}
+
+func TestInstrumentDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := NewRegistry()
+	if err := InstrumentDB(db, reg); err != nil {
+		t.Fatal(err)
+	}
+
+	type widget struct {
+		ID   uint
+		Name string
+	}
+	if err := db.AutoMigrate(&widget{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&widget{Name: "a"})
+	var w widget
+	db.First(&w)
+	db.First(&w, 42) // ErrRecordNotFound is not a failure
+	db.Table("missing").Find(&[]widget{})
+
+	out := scrape(t, reg)
+	for _, want := range []string{
+		`db_query_duration_seconds_count{operation="create",table="widgets"} 1`,
+		`db_query_duration_seconds_count{operation="query",table="widgets"} 2`,
+		`db_query_errors_total{operation="query",table="missing"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %s in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `db_query_errors_total{operation="query",table="widgets"}`) {
+		t.Error("ErrRecordNotFound must not count as an error")
+	}
+}
+
+func scrape(t *testing.T, reg *Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type: got %q", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestRegisterBuildInfo(t *testing.T) {
+	t.Setenv("SERVICE_VERSION", "v1.2.3")
+	reg := NewRegistry()
+	RegisterBuildInfo(reg)
+
+	if out := scrape(t, reg); !strings.Contains(out, `build_info{version="v1.2.3",revision="`) {
+		t.Fatalf("missing build_info in\n%s", out)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"time"
+)
+
+// NewAdminMux returns the default handler of the admin listener (see
+// [Server].AdminAddr). It serves the runtime profiles under /debug/pprof/
+// for `go tool pprof`; mount health and metrics handlers on the returned
+// mux as needed.
+//
+// The profiles are served through runtime/pprof rather than by importing
+// net/http/pprof, whose init registers them on http.DefaultServeMux and
+// would leak them to apps serving that mux publicly.
+func NewAdminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pprof/{$}", pprofIndex)
+	mux.HandleFunc("GET /debug/pprof/profile", pprofCPU)
+	mux.HandleFunc("GET /debug/pprof/{name}", pprofProfile)
+	return mux
+}
+
+// newAdminServer builds the *http.Server of the admin listener from the
+// public config c, minus the write timeout: a CPU profile streams for as
+// long as ?seconds= asks, well past DefaultWriteTimeout.
+func newAdminServer(addr string, handler http.Handler, c ServerConfig) *http.Server {
+	c.WriteTimeout = -1
+	return newHTTPServer(addr, handler, c)
+}
+
+func pprofIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<html><body><p>Profiles:</p><ul>\n")
+	fmt.Fprint(w, `<li><a href="profile?seconds=30">profile</a> (CPU, 30s)</li>`+"\n")
+	for _, p := range pprof.Profiles() {
+		name := html.EscapeString(p.Name())
+		fmt.Fprintf(w, "<li><a href=\"%s?debug=1\">%s</a> (%d)</li>\n", name, name, p.Count())
+	}
+	fmt.Fprint(w, "</ul></body></html>\n")
+}
+
+// pprofProfile writes a named profile: the gzipped protobuf format for
+// `go tool pprof`, or text with ?debug=1 (?debug=2 for full goroutine
+// stacks).
+func pprofProfile(w http.ResponseWriter, r *http.Request) {
+	p := pprof.Lookup(r.PathValue("name"))
+	if p == nil {
+		http.Error(w, "unknown profile", http.StatusNotFound)
+		return
+	}
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	if debug > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", p.Name()))
+	}
+	p.WriteTo(w, debug)
+}
+
+// pprofCPU records a CPU profile for ?seconds=N (default 30).
+func pprofCPU(w http.ResponseWriter, r *http.Request) {
+	sec, err := strconv.Atoi(r.FormValue("seconds"))
+	if err != nil || sec <= 0 {
+		sec = 30
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="profile"`)
+	if err := pprof.StartCPUProfile(w); err != nil {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, fmt.Sprintf("cannot start CPU profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer pprof.StopCPUProfile()
+	select {
+	case <-time.After(time.Duration(sec) * time.Second):
+	case <-r.Context().Done():
+	}
+}
@@ -7,71 +7,356 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 
+	viperdecode "github.com/go-viper/mapstructure/v2"
 	"github.com/mitchellh/mapstructure"
 	"github.com/sebatec-eu/config-mate/v2/core"
 	"github.com/sebatec-eu/config-mate/v2/hostsharing"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 // ReadInConfig loads config into rawVal. App name: [core.ServiceName].
-// Missing file is not an error: rawVal keeps its zero values plus any prior
-// viper.SetDefault calls (viper ignores mapstructure `default:` tags).
+// Missing file is not an error: rawVal gets the `default:"…"` tag values
+// of its fields (e.g. default:"9000", default:"5s"), other fields stay
+// zero. Fields tagged `required:"true"`, or `validate:"required"`, must end
+// up non-zero; otherwise a [*MissingConfigError] lists every missing key
+// and the paths searched.
+// Then rawVal is checked with [ValidateConfig].
 //
-// Search order:
-//  1. <domain.ConfigDir>/<app> — PAC layout (CONFIG_BASE_PATH honored for dev).
-//  2. $XDG_CONFIG_HOME/<app>/<app>.{ext}, then $XDG_CONFIG_HOME/<app>.{ext}
-//     (or $HOME/.config fallback).
+// Config files are looked for in these locations, from highest to lowest
+// precedence:
+//  1. <domain.ConfigDir> — PAC layout (CONFIG_BASE_PATH honored for dev).
+//  2. $XDG_CONFIG_HOME/<app>, then $XDG_CONFIG_HOME (or $HOME/.config
+//     fallback).
 //  3. $HOME/.<app> (legacy).
 //
-// File basename must equal <appName>. Extensions: yaml, yml, json, toml,
-// properties, props, prop, hcl, tfvars, dotenv, env, ini; extensionless
-// <appName> also works because SetConfigType("yaml") is set.
+// Each location may hold, from lowest to highest precedence:
+//   - the base file <app>.{ext}, or <app> without extension as YAML;
+//   - the overlay <app>.<env>.{ext}, where env is APP_ENV (e.g.
+//     myapp.production.yaml), skipped when APP_ENV is unset;
+//   - drop-in files <app>.d/*.{ext}, in lexical order of their names.
+//
+// All files found are merged: a key from a file of higher precedence
+// replaces the same key from one of lower precedence, nested maps are
+// merged key by key. Keep shared defaults in the base file and secrets in
+// a drop-in such as <app>.d/secrets.yaml. The format follows the
+// extension: yaml, yml, json, toml, dotenv or env.
+//
+// Environment variables override all files: the key path upper-cased,
+// dots replaced by underscores, prefixed with the app name, e.g.
+// MYAPP_DATABASE_DSN for database.dsn of app "myapp" (see [ConfigEnvVar]).
+// Every field of rawVal can be overridden, including fields absent from
+// the file.
+//
+// Fields tagged `secret:"true"` may refer to secrets kept elsewhere:
+// file:/abs/path, env:NAME or enc:… sealed with the key in <app>.key,
+// looked for in the same locations as the config files (see
+// [core.SecretRefHookFunc]). Values of other fields are taken as they are.
 //
 // rawVal must be a pointer. fs adds mapstructure decode hooks; when empty,
-// defaults are Base64StringToBytesHookFunc(Std, URL), StringToTimeDurationHookFunc,
-// StringToSliceHookFunc(",").
+// defaults are, in order, core's Base64StringToBytesHookFunc(Std, URL),
+// mapstructure's
+// StringToTimeDurationHookFunc, core's StringToByteSizeHookFunc,
+// StringToURLHookFunc, StringToTimeLocationHookFunc,
+// StringToFileModeHookFunc and TextUnmarshalerHookFunc, and finally
+// mapstructure's StringToSliceHookFunc(","). Pass [DefaultDecodeHooks]
+// plus your own to extend them.
 func ReadInConfig(rawVal any, fs ...mapstructure.DecodeHookFunc) error {
-	appName, err := core.ServiceName()
+	l, err := newConfigLoader(fs, "")
 	if err != nil {
 		return err
 	}
+	if err := l.read(); err != nil {
+		return err
+	}
+	return l.decode(rawVal)
+}
+
+// configLoader keeps the viper instance and decode hooks of a config, so
+// it can be read again when a file changes.
+type configLoader struct {
+	v         *viper.Viper
+	hooks     mapstructure.DecodeHookFunc
+	secretRef mapstructure.DecodeHookFuncType // resolves `secret:"true"` fields
+	appName   string
+	env       string                 // APP_ENV, selects the overlay file
+	paths     []string               // search paths, highest precedence first
+	file      string                 // explicit config file, replaces paths
+	flags     map[string]*pflag.Flag // command-line flags bound to keys
+	files     []string               // files merged by the last read, lowest precedence first
+	layers    []map[string]any       // parsed files, in the order of files
+}
+
+// newConfigLoader prepares reading the config of the app. A non-empty file
+// is read instead of searching the config locations.
+func newConfigLoader(fs []mapstructure.DecodeHookFunc, file string) (*configLoader, error) {
+	appName, err := core.ServiceName()
+	if err != nil {
+		return nil, err
+	}
 
 	v := viper.New()
-	v.SetConfigType("yaml")
-	v.SetConfigName(appName)
+	v.SetConfigType("yaml") // for the empty reset in read; files are parsed on their own
+	v.SetEnvPrefix(envPrefix(appName))
+	v.SetEnvKeyReplacer(envKeyReplacer)
+	v.AutomaticEnv()
+
+	var paths []string
+	keyPaths := []string{filepath.Dir(file)}
+	if file == "" {
+		paths = searchPaths(appName)
+		keyPaths = paths
+	}
+
+	if len(fs) <= 0 {
+		fs = DefaultDecodeHooks()
+	}
+	return &configLoader{
+		v:         v,
+		hooks:     mapstructure.ComposeDecodeHookFunc(fs...),
+		secretRef: core.SecretRefHookFunc(secretKeyFile(keyPaths, appName)),
+		appName:   appName,
+		env:       os.Getenv("APP_ENV"),
+		paths:     paths,
+		file:      file,
+	}, nil
+}
 
+// searchPaths returns the config locations, highest precedence first.
+func searchPaths(appName string) []string {
+	var paths []string
 	if cfgDir, err := hostsharingConfigDir(); err != nil {
 		log.Printf("config-mate: PAC detection failed (%v); continuing with XDG fallback", err)
 	} else if cfgDir != "" {
-		v.AddConfigPath(cfgDir)
-	}
-	for _, p := range core.XdgConfigDirs(appName) {
-		v.AddConfigPath(p)
+		paths = append(paths, filepath.Clean(cfgDir))
 	}
+	paths = append(paths, core.XdgConfigDirs(appName)...)
 	if home := os.Getenv("HOME"); home != "" {
-		v.AddConfigPath(filepath.Join(home, "."+appName))
+		paths = append(paths, filepath.Join(home, "."+appName))
 	}
+	return paths
+}
 
-	if err := v.ReadInConfig(); err != nil && !errors.As(err, &viper.ConfigFileNotFoundError{}) {
-		return fmt.Errorf("cannot read config: %w", err)
+// DefaultDecodeHooks returns the decode hooks [ReadInConfig] uses when
+// given none: to add a hook of your own, pass it together with these.
+//
+// The slice hook goes last: it splits any string decoded into a slice,
+// which would break types such as net.IP that are slices themselves.
+func DefaultDecodeHooks() []mapstructure.DecodeHookFunc {
+	return []mapstructure.DecodeHookFunc{
+		core.Base64StringToBytesHookFunc(base64.StdEncoding, base64.URLEncoding),
+		mapstructure.StringToTimeDurationHookFunc(),
+		core.StringToByteSizeHookFunc(),
+		core.StringToURLHookFunc(),
+		core.StringToTimeLocationHookFunc(),
+		core.StringToFileModeHookFunc(),
+		core.TextUnmarshalerHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
 	}
+}
 
-	if len(fs) <= 0 {
-		fs = append(fs,
-			core.Base64StringToBytesHookFunc(base64.StdEncoding, base64.URLEncoding),
-			mapstructure.StringToTimeDurationHookFunc(),
-			mapstructure.StringToSliceHookFunc(","),
-		)
+// secretKeyFile returns the first <app>.key in the search paths. When there
+// is none, it names the one of highest precedence, so that an enc: value
+// reports where the key was expected.
+func secretKeyFile(paths []string, appName string) string {
+	for _, dir := range paths {
+		if f := filepath.Join(dir, appName+".key"); isRegularFile(f) {
+			return f
+		}
 	}
+	if len(paths) == 0 {
+		return ""
+	}
+	return filepath.Join(paths[0], appName+".key")
+}
+
+// read (re)reads and merges the config files. No file is not an error.
+// When a file cannot be read, the previous config is left in place.
+func (l *configLoader) read() error {
+	files := l.configFiles()
+	layers, err := parseConfigFiles(files)
+	if err != nil {
+		return err
+	}
+	if err := l.v.ReadConfig(strings.NewReader("")); err != nil {
+		return fmt.Errorf("cannot reset config: %w", err)
+	}
+	for _, layer := range layers {
+		if err := l.v.MergeConfigMap(layer); err != nil {
+			return fmt.Errorf("cannot merge config: %w", err)
+		}
+	}
+	l.files, l.layers = files, layers
+	return nil
+}
 
-	if err := v.Unmarshal(&rawVal, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(fs...))); err != nil {
+func (l *configLoader) decode(rawVal any) error {
+	fields := configFields(rawVal)
+	for _, f := range fields {
+		// viper only unmarshals keys it knows of; binding every field lets
+		// env vars set keys that are missing from the file.
+		if err := l.v.BindEnv(f.key); err != nil {
+			return fmt.Errorf("cannot bind env for %s: %w", f.key, err)
+		}
+		if def, ok := f.field.Tag.Lookup("default"); ok {
+			l.v.SetDefault(f.key, def)
+		}
+	}
+	settings := l.v.AllSettings()
+	if err := l.resolveSecrets(settings, fields); err != nil {
 		return fmt.Errorf("cannot unmarshal config: %v", err)
 	}
+	// As viper.Unmarshal does, on the settings with secrets resolved.
+	dec, err := viperdecode.NewDecoder(&viperdecode.DecoderConfig{
+		WeaklyTypedInput: true,
+		DecodeHook:       l.hooks,
+		Result:           &rawVal,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal config: %v", err)
+	}
+	if err := dec.Decode(settings); err != nil {
+		return fmt.Errorf("cannot unmarshal config: %v", err)
+	}
+	return errors.Join(l.checkRequired(rawVal, fields), validateConfig(rawVal, true))
+}
 
+// resolveSecrets replaces file:, env: and enc: references in the values of
+// `secret:"true"` fields, strings or lists of strings, with the secrets.
+func (l *configLoader) resolveSecrets(settings map[string]any, fields []configField) error {
+	for _, f := range fields {
+		if f.field.Tag.Get("secret") != "true" {
+			continue
+		}
+		path := strings.Split(f.key, ".")
+		m := settings
+		for _, p := range path[:len(path)-1] {
+			if m, _ = m[p].(map[string]any); m == nil {
+				break
+			}
+		}
+		if m == nil {
+			continue
+		}
+		name := path[len(path)-1]
+		switch v := m[name].(type) {
+		case string:
+			s, err := l.resolveSecret(f.key, v)
+			if err != nil {
+				return err
+			}
+			m[name] = s
+		case []any:
+			// A copy: the slice may be shared with the merged files.
+			list := make([]any, len(v))
+			for i, e := range v {
+				list[i] = e
+				if s, ok := e.(string); ok {
+					r, err := l.resolveSecret(f.key, s)
+					if err != nil {
+						return err
+					}
+					list[i] = r
+				}
+			}
+			m[name] = list
+		}
+	}
 	return nil
 }
 
+func (l *configLoader) resolveSecret(key, s string) (any, error) {
+	v, err := l.secretRef(stringType, stringType, s) // passes other values through
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return v, nil
+}
+
+// checkRequired fails for every required field that is zero: tagged
+// `required:"true"` or with the validate rule required, which mean the
+// same for a config key.
+func (l *configLoader) checkRequired(rawVal any, fields []configField) error {
+	root := reflect.ValueOf(rawVal)
+	var missing []string
+	for _, f := range fields {
+		if f.field.Tag.Get("required") != "true" && !hasRule(f.field.Tag.Get("validate"), "required") {
+			continue
+		}
+		if v, ok := f.value(root); !ok || v.IsZero() {
+			missing = append(missing, f.key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &MissingConfigError{
+		Keys:   missing,
+		Prefix: envPrefix(l.appName),
+		Files:  l.files,
+		Paths:  l.paths,
+	}
+}
+
+// MissingConfigError reports required config keys that are not set.
+type MissingConfigError struct {
+	Keys   []string // dotted key paths, e.g. database.dsn
+	Prefix string   // env var prefix, e.g. MYAPP
+	Files  []string // config files merged, lowest precedence first
+	Paths  []string // directories searched for the config file
+}
+
+func (e *MissingConfigError) Error() string {
+	var b strings.Builder
+	b.WriteString("missing required config: ")
+	for i, k := range e.Keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s (env %s)", k, envVarName(e.Prefix, k))
+	}
+	if len(e.Files) > 0 {
+		fmt.Fprintf(&b, "; read %s (searched %s)", strings.Join(e.Files, ", "), strings.Join(e.Paths, ", "))
+	} else {
+		fmt.Fprintf(&b, "; no config file found in %s", strings.Join(e.Paths, ", "))
+	}
+	return b.String()
+}
+
+var envKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// envPrefix turns an app name into an env var prefix: upper case, with
+// every character other than letters and digits replaced by "_".
+func envPrefix(appName string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, appName)
+}
+
+// ConfigEnvVar returns the env var that overrides key (e.g. "database.dsn")
+// in the config of the app named by [core.ServiceName].
+func ConfigEnvVar(key string) (string, error) {
+	appName, err := core.ServiceName()
+	if err != nil {
+		return "", err
+	}
+	return envVarName(envPrefix(appName), key), nil
+}
+
+func envVarName(prefix, key string) string {
+	return prefix + "_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
+
 // hostsharingConfigDir returns the PAC layout ConfigDir, or ("", nil) for
 // no match. ErrShortPath is treated as a non-match (expected for non-PAC
 // deployments). Test seam: DomainByExecutable's *domain is unexported, so
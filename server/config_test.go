@@ -2,16 +2,25 @@ package server
 
 import (
 	"bytes"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"log/slog"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/sebatec-eu/config-mate/v2/core"
 )
 
-// ReadInConfig does not honour mapstructure `default:` tags; missing configs
-// leave Foo at its zero value, which is what most subtests assert.
+// Foo has no `default:` tag, so missing configs leave it at its zero value,
+// which is what most subtests assert.
 
 func TestReadInConfig(t *testing.T) {
 	const (
@@ -213,3 +222,249 @@ func withStubbedHostsharing(t *testing.T, stub func() (string, error)) {
 	log.SetOutput(&buf)
 	t.Cleanup(func() { log.SetOutput(origLog) })
 }
+
+type configNode struct {
+	Name     string       `mapstructure:"name"`
+	Next     *configNode  `mapstructure:"next"`
+	Children []configNode `mapstructure:"children"`
+	Tags     map[string]*configNode
+}
+
+// A config type that contains itself ends in a leaf at the repeat instead
+// of recursing without end.
+func TestConfigFields_RecursiveType(t *testing.T) {
+	var cfg struct {
+		Root configNode `mapstructure:"root"`
+	}
+	var keys []string
+	for _, f := range configFields(&cfg) {
+		keys = append(keys, f.key)
+	}
+	if got := strings.Join(keys, " "); got != "root.name root.next root.children root.tags" {
+		t.Errorf("keys: got %s", got)
+	}
+}
+
+// Env vars override file values and set keys the file does not have.
+func TestReadInConfig_EnvOverrides(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("SERVICE_NAME", "my-app")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("CONFIG_BASE_PATH", "")
+	t.Setenv("HOME", home)
+	mustWrite(t, filepath.Join(home, ".config", "my-app.yaml"), "foo: from-file\ndatabase:\n  type: sqlite\n")
+
+	t.Setenv("MY_APP_FOO", "from-env")
+	t.Setenv("MY_APP_DATABASE_DSN", "file:test.db")
+	t.Setenv("MY_APP_HTTP_TIMEOUT", "3s")
+	t.Setenv("MY_APP_TAGS", "a,b")
+
+	var cfg struct {
+		Foo      string
+		Database struct {
+			Type string
+			DSN  string `mapstructure:"dsn"`
+		}
+		SquashedConfig `mapstructure:",squash"`
+	}
+	if err := ReadInConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Foo != "from-env" || cfg.Database.Type != "sqlite" || cfg.Database.DSN != "file:test.db" {
+		t.Fatalf("got %+v", cfg)
+	}
+	if cfg.HTTP.Timeout != 3*time.Second || len(cfg.Tags) != 2 {
+		t.Fatalf("squashed fields: got %+v", cfg.SquashedConfig)
+	}
+	if name, _ := ConfigEnvVar("database.dsn"); name != "MY_APP_DATABASE_DSN" {
+		t.Fatalf("ConfigEnvVar: got %s", name)
+	}
+}
+
+type SquashedConfig struct {
+	HTTP struct {
+		Timeout time.Duration
+	} `mapstructure:"http"`
+	Tags []string
+}
+
+func TestReadInConfig_DefaultAndRequiredTags(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("CONFIG_BASE_PATH", "")
+	t.Setenv("HOME", home)
+	t.Setenv("MYAPP_API_KEY", "")
+	mustWrite(t, filepath.Join(home, ".config", "myapp.yaml"), "port: 8080\ndatabase:\n  dsn: \"\"\n")
+
+	type config struct {
+		Port     int           `default:"9000"`
+		Timeout  time.Duration `default:"5s"`
+		Hosts    []string      `default:"a,b"`
+		Database struct {
+			DSN string `mapstructure:"dsn" required:"true"`
+		}
+		APIKey string `mapstructure:"api_key" required:"true"`
+	}
+
+	var cfg config
+	err := ReadInConfig(&cfg)
+	var missing *MissingConfigError
+	if !errors.As(err, &missing) {
+		t.Fatalf("want MissingConfigError, got %v", err)
+	}
+	for _, w := range []string{"database.dsn (env MYAPP_DATABASE_DSN)", "api_key (env MYAPP_API_KEY)", "read " + filepath.Join(home, ".config", "myapp.yaml"), filepath.Join(home, ".myapp")} {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("want %q in %q", w, err)
+		}
+	}
+
+	t.Setenv("MYAPP_DATABASE_DSN", "file:app.db")
+	t.Setenv("MYAPP_API_KEY", "k")
+	cfg = config{}
+	if err := ReadInConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != 8080 || cfg.Timeout != 5*time.Second || len(cfg.Hosts) != 2 || cfg.Database.DSN != "file:app.db" {
+		t.Fatalf("got %+v", cfg)
+	}
+}
+
+// Files of all locations are merged: locations by search order, and
+// within one the base file, the APP_ENV overlay and then the drop-ins.
+func TestReadInConfig_MergesLayers(t *testing.T) {
+	home := t.TempDir()
+	pac := filepath.Join(home, "doms", "example.com", "etc")
+	withStubbedHostsharing(t, func() (string, error) { return pac, nil })
+	xdg := filepath.Join(home, "xdg")
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", xdg)
+	t.Setenv("HOME", home)
+	t.Setenv("APP_ENV", "production")
+	t.Setenv("MYAPP_E", "from-env")
+
+	mustWrite(t, filepath.Join(home, ".myapp", "myapp.yaml"), "a: home\nb: home\nnested:\n  x: home\n  y: home\n")
+	mustWrite(t, filepath.Join(xdg, "myapp.yaml"), "b: xdg\nc: xdg\n")
+	mustWrite(t, filepath.Join(xdg, "myapp.production.yaml"), "c: xdg-production\nnested:\n  x: xdg-production\n")
+	mustWrite(t, filepath.Join(xdg, "myapp.staging.yaml"), "a: staging\n")
+	mustWrite(t, filepath.Join(pac, "myapp.toml"), "d = \"pac\"\ne = \"pac\"\n")
+	mustWrite(t, filepath.Join(pac, "myapp.d", "10-secrets.yaml"), "d: secret\n")
+	mustWrite(t, filepath.Join(pac, "myapp.d", "20-override.json"), `{"d": "json"}`)
+	mustWrite(t, filepath.Join(pac, "myapp.d", ".30-hidden.yaml"), "d: hidden\n")
+	mustWrite(t, filepath.Join(pac, "myapp.d", "40-notes.txt"), "d: notes\n")
+	mustWrite(t, filepath.Join(pac, "myapp.d", "50-legacy.ini"), "d = ini\n")
+
+	var cfg struct {
+		A, B, C, D, E string
+		Nested        struct{ X, Y string }
+	}
+	if err := ReadInConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.A != "home" || cfg.B != "xdg" || cfg.C != "xdg-production" || cfg.D != "json" || cfg.E != "from-env" {
+		t.Errorf("got %+v", cfg)
+	}
+	if cfg.Nested.X != "xdg-production" || cfg.Nested.Y != "home" {
+		t.Errorf("nested maps must merge key by key, got %+v", cfg.Nested)
+	}
+}
+
+// A broken drop-in fails the read and names the file.
+func TestReadInConfig_BrokenDropIn(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("CONFIG_BASE_PATH", "")
+	t.Setenv("HOME", home)
+	mustWrite(t, filepath.Join(home, ".config", "myapp.yaml"), "foo: ok\n")
+	broken := filepath.Join(home, ".config", "myapp.d", "broken.json")
+	mustWrite(t, broken, "{")
+
+	var cfg struct{ Foo string }
+	if err := ReadInConfig(&cfg); err == nil || !strings.Contains(err.Error(), broken) {
+		t.Fatalf("want error naming %s, got %v", broken, err)
+	}
+}
+
+// Secret references resolve by default; the key for enc: values sits next
+// to the config file.
+func TestReadInConfig_SecretRefs(t *testing.T) {
+	home := t.TempDir()
+	pac := filepath.Join(home, "doms", "example.com", "etc")
+	withStubbedHostsharing(t, func() (string, error) { return pac, nil })
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", home)
+	t.Setenv("DB_PASSWORD", "from-env")
+
+	keyFile := filepath.Join(pac, "myapp.key")
+	mustWrite(t, keyFile, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	key, err := core.ReadSecretKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := core.EncryptSecret(key, []byte("5s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenFile := filepath.Join(home, "token")
+	mustWrite(t, tokenFile, "from-file\n")
+	dbFile := filepath.Join(home, "app.db")
+	mustWrite(t, dbFile, "SQLite format 3")
+	mustWrite(t, filepath.Join(pac, "myapp.yaml"), fmt.Sprintf(
+		"password: env:DB_PASSWORD\ntoken: file:%s\ntimeout: %s\nkeys: [env:DB_PASSWORD, plain]\ndsn: file:%s\nnote: env:UNSET_VAR\n",
+		tokenFile, sealed, dbFile))
+
+	var cfg struct {
+		Password string        `secret:"true"`
+		Token    string        `secret:"true"`
+		Timeout  time.Duration `secret:"true"`
+		Keys     []string      `secret:"true"`
+		DSN      string        // not a secret: taken as it is
+		Note     string
+	}
+	if err := ReadInConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Password != "from-env" || cfg.Token != "from-file" || cfg.Timeout != 5*time.Second {
+		t.Fatalf("got %+v", cfg)
+	}
+	if len(cfg.Keys) != 2 || cfg.Keys[0] != "from-env" || cfg.Keys[1] != "plain" {
+		t.Fatalf("keys: got %q", cfg.Keys)
+	}
+	if cfg.DSN != "file:"+dbFile || cfg.Note != "env:UNSET_VAR" {
+		t.Fatalf("untagged fields must stay unchanged, got dsn %q, note %q", cfg.DSN, cfg.Note)
+	}
+}
+
+func TestReadInConfig_DefaultHooks(t *testing.T) {
+	home := t.TempDir()
+	pac := filepath.Join(home, "doms", "example.com", "etc")
+	withStubbedHostsharing(t, func() (string, error) { return pac, nil })
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", home)
+	t.Setenv("MYAPP_TRUSTED", "10.0.0.0/8,192.168.0.0/16")
+	t.Setenv("MYAPP_LIMIT", "0x10") // as mapstructure decoded it before
+	mustWrite(t, filepath.Join(pac, "myapp.yaml"), "max_body: 10MiB\nmode: \"0640\"\nupstream: http://backend:8080\nzone: Europe/Berlin\nlevel: warn\nport: 8080\n")
+
+	var cfg struct {
+		MaxBody  int64          `mapstructure:"max_body"`
+		Mode     fs.FileMode    `mapstructure:"mode"`
+		Upstream *url.URL       `mapstructure:"upstream"`
+		Zone     *time.Location `mapstructure:"zone"`
+		Trusted  []netip.Prefix `mapstructure:"trusted"`
+		Level    slog.Level     `mapstructure:"level"`
+		Port     int64          `mapstructure:"port"`
+		Limit    int64          `mapstructure:"limit"`
+	}
+	if err := ReadInConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxBody != 10<<20 || cfg.Mode != 0o640 || cfg.Level != slog.LevelWarn || cfg.Port != 8080 || cfg.Limit != 16 {
+		t.Fatalf("got %+v", cfg)
+	}
+	if cfg.Upstream.Host != "backend:8080" || cfg.Zone.String() != "Europe/Berlin" || len(cfg.Trusted) != 2 {
+		t.Fatalf("got %+v", cfg)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// configField is a leaf of a config struct as viper sees it: key is the
+// lower-case dotted path built from the mapstructure tags.
+type configField struct {
+	key   string
+	field reflect.StructField
+	index []int // path from the root struct, through pointers
+}
+
+// value returns the field within root (a pointer to the config struct), or
+// false when a pointer on the way is nil.
+func (f configField) value(root reflect.Value) (reflect.Value, bool) {
+	v := root
+	for _, i := range f.index {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+var (
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	urlType             = reflect.TypeFor[url.URL]()
+	locationType        = reflect.TypeFor[time.Location]()
+)
+
+// configFields lists the leaves of the struct behind rawVal, following
+// mapstructure's naming: the tag name or the field name, ",squash" for
+// embedding without a prefix, "-" to skip. Nested structs (and pointers to
+// them) are descended into; everything else, including types that decode
+// from text such as time.Time, is a leaf. So is a field of a struct type
+// that already encloses it, such as Next in type Node struct{ Next *Node },
+// which has no finite list of keys.
+func configFields(rawVal any) []configField {
+	t := reflect.TypeOf(rawVal)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return appendConfigFields(nil, t, "", nil, map[reflect.Type]bool{})
+}
+
+// appendConfigFields appends the leaves of t; path holds the struct types
+// enclosing t, t included while its fields are listed.
+func appendConfigFields(fields []configField, t reflect.Type, prefix string, index []int, path map[reflect.Type]bool) []configField {
+	path[t] = true
+	defer delete(path, t)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, squash, ok := configFieldName(f)
+		if !ok {
+			continue
+		}
+		key := prefix + name
+		idx := append(index[:len(index):len(index)], i)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if !isConfigStruct(ft) || path[ft] {
+			fields = append(fields, configField{key: key, field: f, index: idx})
+			continue
+		}
+		if squash {
+			fields = appendConfigFields(fields, ft, prefix, idx, path)
+		} else {
+			fields = appendConfigFields(fields, ft, key+".", idx, path)
+		}
+	}
+	return fields
+}
+
+// configFieldName returns the lower-case key of f as mapstructure names
+// it, whether f is squashed into its parent, and false for fields that
+// are not decoded.
+func configFieldName(f reflect.StructField) (name string, squash, ok bool) {
+	if !f.IsExported() {
+		return "", false, false
+	}
+	name, opts, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+	if name == "-" || strings.Contains(opts, "remain") {
+		return "", false, false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return strings.ToLower(name), strings.Contains(opts, "squash"), true
+}
+
+// isConfigStruct reports whether t is a struct whose fields are config
+// keys, rather than a value decoded from text such as time.Time or
+// url.URL.
+func isConfigStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != urlType && t != locationType &&
+		!t.Implements(textUnmarshalerType) && !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
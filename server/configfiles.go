@@ -0,0 +1,158 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// dropInSuffix names the drop-in directory next to a base file:
+// <app>.d/*.yaml is merged over <app>.yaml.
+const dropInSuffix = ".d"
+
+// configExts are the extensions of config files, in the order
+// findConfigFile tries them. viper reads more formats, such as ini and hcl,
+// but those are not looked for.
+var configExts = []string{"json", "toml", "yaml", "yml", "dotenv", "env"}
+
+// configFiles returns the config files to merge, lowest precedence first.
+// Locations are merged from the last search path to the first, so the PAC
+// ConfigDir wins over XDG, which wins over $HOME/.<app>. Within a location
+// the base <app>.{ext} comes first, then the overlay <app>.<env>.{ext} for
+// APP_ENV, then <app>.d/*.{ext} in lexical order.
+func (l *configLoader) configFiles() []string {
+	if l.file != "" {
+		return []string{l.file}
+	}
+	var files []string
+	for _, dir := range slices.Backward(l.paths) {
+		if f := findConfigFile(dir, l.appName, true); f != "" {
+			files = append(files, f)
+		}
+		if l.env != "" {
+			if f := findConfigFile(dir, l.appName+"."+l.env, false); f != "" {
+				files = append(files, f)
+			}
+		}
+		files = append(files, dropInFiles(filepath.Join(dir, l.appName+dropInSuffix))...)
+	}
+	return files
+}
+
+// findConfigFile returns dir/name.{ext} for the first of configExts that
+// exists, then dir/name when bare is set.
+func findConfigFile(dir, name string, bare bool) string {
+	for _, ext := range configExts {
+		if f := filepath.Join(dir, name+"."+ext); isRegularFile(f) {
+			return f
+		}
+	}
+	if f := filepath.Join(dir, name); bare && isRegularFile(f) {
+		return f
+	}
+	return ""
+}
+
+// dropInFiles lists the config files in dir by name. Hidden files and
+// files without a supported extension, such as editor backups, are left
+// out.
+func dropInFiles(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, e := range entries {
+		if f := filepath.Join(dir, e.Name()); isDropIn(e.Name()) && isRegularFile(f) {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func isDropIn(name string) bool {
+	return !strings.HasPrefix(name, ".") && filepath.Ext(name) != "" && slices.Contains(configExts, configType(name))
+}
+
+func isRegularFile(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// configType is the format of a config file, taken from its extension;
+// extensionless files are YAML.
+func configType(file string) string {
+	if ext := filepath.Ext(file); len(ext) > 1 {
+		return strings.ToLower(ext[1:])
+	}
+	return "yaml"
+}
+
+// parseConfigFiles parses every file on its own, so that a broken file is
+// reported before anything is merged.
+func parseConfigFiles(files []string) ([]map[string]any, error) {
+	layers := make([]map[string]any, 0, len(files))
+	for _, f := range files {
+		fv := viper.New()
+		fv.SetConfigFile(f)
+		fv.SetConfigType(configType(f))
+		if err := fv.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("cannot read config %s: %w", f, err)
+		}
+		layers = append(layers, fv.AllSettings())
+	}
+	return layers, nil
+}
+
+// watchDirs are the existing directories that can hold config files:
+// every search path and its drop-in directory.
+func (l *configLoader) watchDirs() []string {
+	if l.file != "" {
+		return []string{filepath.Dir(l.file)}
+	}
+	var dirs []string
+	for _, dir := range l.paths {
+		for _, d := range []string{dir, filepath.Join(dir, l.appName+dropInSuffix)} {
+			if fi, err := os.Stat(d); err == nil && fi.IsDir() {
+				dirs = append(dirs, d)
+			}
+		}
+	}
+	return dirs
+}
+
+// isDropInDir reports whether path is the drop-in directory of a search
+// path.
+func (l *configLoader) isDropInDir(path string) bool {
+	dir, name := filepath.Split(filepath.Clean(path))
+	return name == l.appName+dropInSuffix && slices.Contains(l.paths, filepath.Clean(dir))
+}
+
+// isConfigFile reports whether a change to path can change the merged
+// config: a base, overlay or drop-in file of one of the search paths,
+// whether or not it exists.
+func (l *configLoader) isConfigFile(path string) bool {
+	if l.file != "" {
+		return filepath.Clean(path) == filepath.Clean(l.file)
+	}
+	dir, name := filepath.Split(filepath.Clean(path))
+	dir = filepath.Clean(dir)
+	if l.isDropInDir(dir) {
+		return isDropIn(name)
+	}
+	if !slices.Contains(l.paths, dir) {
+		return false
+	}
+	if name == l.appName {
+		return true
+	}
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	if !slices.Contains(configExts, configType(name)) {
+		return false
+	}
+	return stem == l.appName || l.env != "" && stem == l.appName+"."+l.env
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+)
+
+// configFileFlag names the flag with an explicit config file.
+const configFileFlag = "config"
+
+// ReadInConfigWithFlags reads the config like [ReadInConfigWithReport],
+// with command-line flags taking precedence over env vars and files.
+//
+// Every field of rawVal tagged `flag:"listen-addr"` gets a flag of that
+// name on flags, typed after the field, with its `doc:"…"` tag as usage
+// and its `default:"…"` tag as shown default. A flag the app defined
+// before under that name is bound instead. Only flags given on the command
+// line override the config. In addition --config names a file to read
+// instead of searching the config locations; the key for enc: values is
+// then looked for next to it.
+//
+// args, usually os.Args[1:], are parsed into flags, so the app can define
+// its own flags, e.g. --print-config, before the call and read them after.
+// The error of flags.Parse, including pflag.ErrHelp, is returned as is.
+func ReadInConfigWithFlags(rawVal any, flags *pflag.FlagSet, args []string, fs ...mapstructure.DecodeHookFunc) (*ConfigReport, error) {
+	bound, err := addConfigFlags(flags, rawVal)
+	if err != nil {
+		return nil, err
+	}
+	if flags.Lookup(configFileFlag) == nil {
+		flags.String(configFileFlag, "", "read this config file instead of searching the config locations")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	l, err := newConfigLoader(fs, flags.Lookup(configFileFlag).Value.String())
+	if err != nil {
+		return nil, err
+	}
+	for key, f := range bound {
+		if !f.Changed {
+			// viper would fall back to the zero value of the flag and
+			// override presets and defaults with it.
+			continue
+		}
+		if err := l.v.BindPFlag(key, f); err != nil {
+			return nil, fmt.Errorf("cannot bind flag --%s: %w", f.Name, err)
+		}
+	}
+	l.flags = bound
+	if err := l.read(); err != nil {
+		return nil, err
+	}
+	err = l.decode(rawVal)
+	return l.report(rawVal), err
+}
+
+// addConfigFlags defines the flags of the `flag:"…"` tagged fields of
+// rawVal and returns them by config key.
+func addConfigFlags(flags *pflag.FlagSet, rawVal any) (map[string]*pflag.Flag, error) {
+	bound := map[string]*pflag.Flag{}
+	for _, f := range configFields(rawVal) {
+		name := f.field.Tag.Get("flag")
+		if name == "" {
+			continue
+		}
+		if name == configFileFlag {
+			return nil, fmt.Errorf("config key %s: flag --%s is reserved", f.key, name)
+		}
+		if flags.Lookup(name) == nil {
+			addConfigFlag(flags, name, f.field.Tag.Get("doc"), f.field.Type)
+			if def, ok := f.field.Tag.Lookup("default"); ok {
+				// Only shown in the usage: the default tag itself applies
+				// through the config defaults.
+				flags.Lookup(name).DefValue = def
+			}
+		}
+		bound[f.key] = flags.Lookup(name)
+	}
+	return bound, nil
+}
+
+func addConfigFlag(flags *pflag.FlagSet, name, usage string, t reflect.Type) {
+	switch {
+	case t == durationType:
+		flags.Duration(name, 0, usage)
+	case t == int64Type || t == fileModeType:
+		// Byte sizes such as 10MiB and octal modes such as 0640.
+		flags.String(name, "", usage)
+	case t.Kind() == reflect.Bool:
+		flags.Bool(name, false, usage)
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		flags.Int64(name, 0, usage)
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		flags.Uint64(name, 0, usage)
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		flags.Float64(name, 0, usage)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		flags.StringSlice(name, nil, usage)
+	default:
+		// Decoded from text by the decode hooks, like a value from a file.
+		flags.String(name, "", usage)
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type flaggedConfig struct {
+	ListenAddr string        `mapstructure:"listen_addr" flag:"listen-addr" doc:"address to listen on" default:":9000"`
+	Timeout    time.Duration `flag:"timeout"`
+	Workers    uint          `flag:"workers"`
+	Debug      bool          `flag:"debug"`
+	Hosts      []string      `flag:"hosts"`
+	Database   struct {
+		DSN string `mapstructure:"dsn" flag:"db-dsn"`
+	}
+	Name string
+}
+
+func setupFlagsTest(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("CONFIG_BASE_PATH", "")
+	t.Setenv("HOME", home)
+	return home
+}
+
+// Flags given on the command line win over env vars and files; flags not
+// given leave the config alone.
+func TestReadInConfigWithFlags(t *testing.T) {
+	home := setupFlagsTest(t)
+	mustWrite(t, filepath.Join(home, ".config", "myapp.yaml"), "listen_addr: :8080\ntimeout: 1s\nname: from-file\ndatabase:\n  dsn: file:file.db\n")
+	t.Setenv("MYAPP_TIMEOUT", "2s")
+
+	flags := pflag.NewFlagSet("myapp", pflag.ContinueOnError)
+	printConfig := flags.Bool("print-config", false, "print the config and exit")
+	var cfg flaggedConfig
+	report, err := ReadInConfigWithFlags(&cfg, flags, []string{"--timeout=3s", "--workers=4", "--debug", "--hosts=a,b", "--db-dsn", "file:flag.db", "--print-config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !*printConfig {
+		t.Error("app flags must be parsed too")
+	}
+	if cfg.ListenAddr != ":8080" || cfg.Timeout != 3*time.Second || cfg.Workers != 4 || !cfg.Debug ||
+		len(cfg.Hosts) != 2 || cfg.Database.DSN != "file:flag.db" || cfg.Name != "from-file" {
+		t.Fatalf("got %+v", cfg)
+	}
+	if f := flags.Lookup("listen-addr"); f.Usage != "address to listen on" || f.DefValue != ":9000" {
+		t.Errorf("listen-addr flag: got %+v", f)
+	}
+
+	var sources []string
+	for _, v := range report.Values {
+		sources = append(sources, v.Key+"="+string(v.Source)+" "+v.Origin)
+	}
+	got := strings.Join(sources, "\n")
+	for _, want := range []string{"timeout=flag --timeout", "database.dsn=flag --db-dsn", "listen_addr=file "} {
+		if !strings.Contains(got, want) {
+			t.Errorf("want %q in\n%s", want, got)
+		}
+	}
+}
+
+// --config reads only the given file.
+func TestReadInConfigWithFlags_ConfigFile(t *testing.T) {
+	home := setupFlagsTest(t)
+	mustWrite(t, filepath.Join(home, ".config", "myapp.yaml"), "name: searched\n")
+	explicit := filepath.Join(home, "elsewhere", "custom.yaml")
+	mustWrite(t, explicit, "name: explicit\n")
+
+	var cfg flaggedConfig
+	report, err := ReadInConfigWithFlags(&cfg, pflag.NewFlagSet("myapp", pflag.ContinueOnError), []string{"--config", explicit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "explicit" || cfg.ListenAddr != ":9000" {
+		t.Fatalf("got %+v", cfg)
+	}
+	if len(report.Files) != 1 || report.Files[0] != explicit || len(report.Paths) != 0 {
+		t.Errorf("report: files %v, paths %v", report.Files, report.Paths)
+	}
+
+	_, err = ReadInConfigWithFlags(&cfg, pflag.NewFlagSet("myapp", pflag.ContinueOnError), []string{"--config", filepath.Join(home, "missing.yaml")})
+	if err == nil {
+		t.Fatal("want error for a missing --config file")
+	}
+}
+
+func TestReadInConfigWithFlags_ParseError(t *testing.T) {
+	setupFlagsTest(t)
+	var cfg flaggedConfig
+	flags := pflag.NewFlagSet("myapp", pflag.ContinueOnError)
+	flags.SetOutput(&strings.Builder{})
+	if _, err := ReadInConfigWithFlags(&cfg, flags, []string{"--workers=-1"}); err == nil {
+		t.Fatal("want parse error")
+	}
+}
+
+// Flags not given leave preset values alone, as ReadInConfig does.
+func TestReadInConfigWithFlags_KeepsPresets(t *testing.T) {
+	setupFlagsTest(t)
+
+	cfg := flaggedConfig{Workers: 7, Hosts: []string{"x"}, Debug: true}
+	if _, err := ReadInConfigWithFlags(&cfg, pflag.NewFlagSet("myapp", pflag.ContinueOnError), nil); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Workers != 7 || len(cfg.Hosts) != 1 || cfg.Hosts[0] != "x" || !cfg.Debug || cfg.ListenAddr != ":9000" {
+		t.Fatalf("got %+v", cfg)
+	}
+}
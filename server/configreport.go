@@ -0,0 +1,155 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// ConfigSource is where the value of a config key came from.
+type ConfigSource string
+
+const (
+	SourceUnset   ConfigSource = "unset"   // zero value, nothing set it
+	SourceDefault ConfigSource = "default" // `default:"…"` tag
+	SourceFile    ConfigSource = "file"    // a config file
+	SourceEnv     ConfigSource = "env"     // an environment variable
+	SourceFlag    ConfigSource = "flag"    // a command-line flag
+)
+
+// ConfigValue is one key of a [ConfigReport].
+type ConfigValue struct {
+	Key    string // dotted key path, e.g. database.dsn
+	Value  string // decoded value for display; "[REDACTED]" for a set secret
+	Source ConfigSource
+	Origin string // file, env var or flag name for SourceFile, SourceEnv and SourceFlag
+	Secret bool   // field is tagged `secret:"true"`
+}
+
+// ConfigReport explains a config read by [ReadInConfigWithReport] or
+// [ReadInConfigWithFlags]: where
+// it was looked for, which files were merged and which source won for
+// every key.
+type ConfigReport struct {
+	Paths  []string // directories searched, highest precedence first; none with --config
+	Files  []string // files merged, lowest precedence first
+	Values []ConfigValue
+}
+
+// ReadInConfigWithReport reads the config into rawVal like [ReadInConfig]
+// and reports where each value came from. The report is also returned when
+// decoding or validation fails, to show why; it is nil only when the
+// config files cannot be read.
+//
+// Fields tagged `secret:"true"` are redacted in the report, so it is safe
+// to print, e.g. for a --print-config flag:
+//
+//	report, err := server.ReadInConfigWithReport(&cfg)
+//	if *printConfig {
+//		report.WriteTo(os.Stdout)
+//	}
+func ReadInConfigWithReport(rawVal any, fs ...mapstructure.DecodeHookFunc) (*ConfigReport, error) {
+	l, err := newConfigLoader(fs, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := l.read(); err != nil {
+		return nil, err
+	}
+	err = l.decode(rawVal)
+	return l.report(rawVal), err
+}
+
+func (l *configLoader) report(rawVal any) *ConfigReport {
+	r := &ConfigReport{Paths: l.paths, Files: l.files}
+	root := reflect.ValueOf(rawVal)
+	prefix := envPrefix(l.appName)
+	for _, f := range configFields(rawVal) {
+		cv := ConfigValue{Key: f.key, Source: SourceUnset, Secret: f.field.Tag.Get("secret") == "true"}
+		if fl := l.flags[f.key]; fl != nil && fl.Changed {
+			cv.Source, cv.Origin = SourceFlag, "--"+fl.Name
+		} else if env := envVarName(prefix, f.key); os.Getenv(env) != "" {
+			cv.Source, cv.Origin = SourceEnv, env
+		} else if file := l.fileOf(f.key); file != "" {
+			cv.Source, cv.Origin = SourceFile, file
+		} else if _, ok := f.field.Tag.Lookup("default"); ok {
+			cv.Source = SourceDefault
+		}
+		if v, ok := f.value(root); ok {
+			cv.Value = formatConfigValue(v, cv.Secret)
+		}
+		r.Values = append(r.Values, cv)
+	}
+	return r
+}
+
+// fileOf returns the file of highest precedence that sets key, or "".
+func (l *configLoader) fileOf(key string) string {
+	for i := len(l.layers) - 1; i >= 0; i-- {
+		if hasKey(l.layers[i], key) {
+			return l.files[i]
+		}
+	}
+	return ""
+}
+
+// hasKey reports whether the dotted key is set in the nested map m.
+func hasKey(m map[string]any, key string) bool {
+	parts := strings.Split(key, ".")
+	for i, p := range parts {
+		v, ok := m[p]
+		if !ok {
+			return false
+		}
+		if i == len(parts)-1 {
+			return true
+		}
+		if m, ok = v.(map[string]any); !ok {
+			return false
+		}
+	}
+	return false
+}
+
+func formatConfigValue(v reflect.Value, secret bool) string {
+	switch {
+	case secret && !v.IsZero():
+		return redacted
+	case v.Kind() == reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	case v.Kind() == reflect.Pointer && v.IsNil():
+		return "nil"
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// WriteTo prints the report, one line per key:
+//
+//	database.dsn = "file:app.db" (env MYAPP_DATABASE_DSN)
+//	api_key = [REDACTED] (file /etc/myapp.d/secrets.yaml)
+//	port = 9000 (default)
+func (r *ConfigReport) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	if len(r.Paths) > 0 {
+		fmt.Fprintf(&b, "# searched: %s\n", strings.Join(r.Paths, ", "))
+	}
+	if len(r.Files) > 0 {
+		fmt.Fprintf(&b, "# files: %s\n", strings.Join(r.Files, ", "))
+	} else {
+		b.WriteString("# files: none\n")
+	}
+	for _, v := range r.Values {
+		fmt.Fprintf(&b, "%s = %s (%s", v.Key, v.Value, v.Source)
+		if v.Origin != "" {
+			fmt.Fprintf(&b, " %s", v.Origin)
+		}
+		b.WriteString(")\n")
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
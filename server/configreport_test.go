@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadInConfigWithReport(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("CONFIG_BASE_PATH", "")
+	t.Setenv("HOME", home)
+	base := filepath.Join(home, ".config", "myapp.yaml")
+	secrets := filepath.Join(home, ".config", "myapp.d", "secrets.yaml")
+	mustWrite(t, base, "name: base\napi_key: from-base\ndatabase:\n  dsn: file:base.db\n")
+	mustWrite(t, secrets, "api_key: s3cret\n")
+	t.Setenv("MYAPP_DATABASE_DSN", "file:env.db")
+
+	var cfg struct {
+		Name     string
+		Port     int    `default:"9000"`
+		APIKey   string `mapstructure:"api_key" secret:"true"`
+		Password string `secret:"true"`
+		Database struct {
+			DSN string `mapstructure:"dsn"`
+		}
+		Debug bool
+	}
+	report, err := ReadInConfigWithReport(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.APIKey != "s3cret" || cfg.Database.DSN != "file:env.db" {
+		t.Fatalf("got %+v", cfg)
+	}
+	if len(report.Files) != 2 || report.Files[0] != base || report.Files[1] != secrets {
+		t.Errorf("Files: got %v", report.Files)
+	}
+
+	var buf bytes.Buffer
+	if _, err := report.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`name = "base" (file ` + base + ")",
+		"port = 9000 (default)",
+		"api_key = [REDACTED] (file " + secrets + ")",
+		`password = "" (unset)`,
+		`database.dsn = "file:env.db" (env MYAPP_DATABASE_DSN)`,
+		"debug = false (unset)",
+		"# searched: ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "s3cret") || strings.Contains(out, "from-base") {
+		t.Errorf("secret leaked:\n%s", out)
+	}
+}
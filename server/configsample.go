@@ -0,0 +1,266 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/sebatec-eu/config-mate/v2/core"
+)
+
+// WriteSampleConfig writes an example config file for rawVal, a pointer to
+// the struct passed to [ReadInConfig], in format "yaml", "toml" or "dotenv"
+// (also "env"), the formats [ReadInConfig] reads from <app>.yaml,
+// <app>.toml and <app>.env. Every key is listed under its mapstructure
+// name with the value of its `default:"…"` tag, or the zero value, and
+// commented out, so the file changes nothing until a line is uncommented:
+//
+//	# address to listen on (env MYAPP_LISTEN_ADDR, flag --listen-addr)
+//	#listen_addr: ":9000"
+//
+// The comment above a key is its `doc:"…"` tag followed by what else
+// applies: required, secret, validate rules, the env var (when
+// [core.ServiceName] is known) and the flag. For example:
+//
+//	server.WriteSampleConfig(os.Stdout, &cfg, "yaml")
+func WriteSampleConfig(w io.Writer, rawVal any, format string) error {
+	var s sampleWriter
+	switch format {
+	case "yaml", "yml":
+		s = yamlSample{}
+	case "toml":
+		s = tomlSample{}
+	case "dotenv", "env":
+		s = dotenvSample{}
+	default:
+		return fmt.Errorf("unknown sample config format %q: want yaml, toml or dotenv", format)
+	}
+
+	var b strings.Builder
+	prefix := ""
+	if appName, err := core.ServiceName(); err == nil {
+		prefix = envPrefix(appName)
+		fmt.Fprintf(&b, "# Sample config of %s.\n", appName)
+	}
+	b.WriteString("# Remove the # in front of a key to set it.\n")
+
+	fields := configFields(rawVal)
+	if _, ok := s.(tomlSample); ok {
+		fields = tomlOrder(fields)
+	}
+	var section []string
+	for _, f := range fields {
+		path := strings.Split(f.key, ".")
+		parent, name := path[:len(path)-1], path[len(path)-1]
+		b.WriteString("\n")
+		depth := s.section(&b, section, parent)
+		section = parent
+		if c := sampleComment(f, prefix); c != "" {
+			fmt.Fprintf(&b, "%s# %s\n", indent(depth), c)
+		}
+		fmt.Fprintf(&b, "%s#%s\n", indent(depth), s.line(f.key, name, newSampleValue(f.field)))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// sampleValue is the value shown for a field: its default tag or zero
+// value, rendered as a sample value.
+type sampleValue struct {
+	t   reflect.Type
+	def string
+	set bool // def comes from a default tag
+}
+
+func newSampleValue(f reflect.StructField) sampleValue {
+	def, ok := f.Tag.Lookup("default")
+	t := f.Type
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return sampleValue{t: t, def: def, set: ok}
+}
+
+// text returns the value as plain text and whether it is a string.
+func (v sampleValue) text() (string, bool) {
+	switch {
+	case v.t == durationType:
+		if !v.set {
+			return "0s", true
+		}
+		return v.def, true
+	case v.t.Kind() == reflect.Bool:
+		if !v.set {
+			return "false", false
+		}
+		return v.def, false
+	case v.t.Kind() >= reflect.Int && v.t.Kind() <= reflect.Float64:
+		if !v.set {
+			return "0", false
+		}
+		// Byte sizes such as "10MiB" and file modes such as "0640" are
+		// strings to the decode hooks.
+		_, err := strconv.ParseFloat(v.def, 64)
+		return v.def, err != nil || v.t == fileModeType
+	default:
+		return v.def, true
+	}
+}
+
+// list returns the elements of a slice value, split from a comma-separated
+// default tag as StringToSliceHookFunc does, and whether they are strings.
+func (v sampleValue) list() ([]string, bool, bool) {
+	if v.t.Kind() != reflect.Slice || v.t.Elem().Kind() == reflect.Uint8 {
+		return nil, false, false
+	}
+	var elems []string
+	if v.def != "" {
+		elems = strings.Split(v.def, ",")
+	}
+	k := v.t.Elem().Kind()
+	isString := !(k == reflect.Bool || k >= reflect.Int && k <= reflect.Float64) || v.t.Elem() == durationType
+	return elems, isString, true
+}
+
+// isMap reports whether v is a table of keys: a map, or a struct type
+// listed as a leaf because it encloses itself.
+func (v sampleValue) isMap() bool { return v.t.Kind() == reflect.Map || isConfigStruct(v.t) }
+
+// sampleWriter renders keys in one file format.
+type sampleWriter interface {
+	// section writes the headers needed to go from the section prev to
+	// parent and returns the indentation depth of keys in parent.
+	section(b *strings.Builder, prev, parent []string) int
+	line(key, name string, v sampleValue) string
+}
+
+type yamlSample struct{}
+
+func (yamlSample) section(b *strings.Builder, prev, parent []string) int {
+	common := 0
+	for common < len(prev) && common < len(parent) && prev[common] == parent[common] {
+		common++
+	}
+	for i := common; i < len(parent); i++ {
+		fmt.Fprintf(b, "%s#%s:\n", indent(i), parent[i])
+	}
+	return len(parent)
+}
+
+func (yamlSample) line(_, name string, v sampleValue) string {
+	return name + ": " + flowValue(v)
+}
+
+type tomlSample struct{}
+
+func (tomlSample) section(b *strings.Builder, prev, parent []string) int {
+	if len(parent) > 0 && strings.Join(prev, ".") != strings.Join(parent, ".") {
+		fmt.Fprintf(b, "#[%s]\n", strings.Join(parent, "."))
+	}
+	return 0
+}
+
+func (tomlSample) line(_, name string, v sampleValue) string {
+	return name + " = " + flowValue(v)
+}
+
+// tomlOrder moves keys without a section first, as keys after a table
+// header belong to that table, and keeps the keys of a table together.
+func tomlOrder(fields []configField) []configField {
+	var top []configField
+	var sections []string
+	bySection := map[string][]configField{}
+	for _, f := range fields {
+		i := strings.LastIndex(f.key, ".")
+		if i < 0 {
+			top = append(top, f)
+			continue
+		}
+		sec := f.key[:i]
+		if _, ok := bySection[sec]; !ok {
+			sections = append(sections, sec)
+		}
+		bySection[sec] = append(bySection[sec], f)
+	}
+	for _, sec := range sections {
+		top = append(top, bySection[sec]...)
+	}
+	return top
+}
+
+type dotenvSample struct{}
+
+func (dotenvSample) section(*strings.Builder, []string, []string) int { return 0 }
+
+func (dotenvSample) line(key, _ string, v sampleValue) string {
+	if elems, _, ok := v.list(); ok {
+		return key + "=" + strings.Join(elems, ",")
+	}
+	if v.isMap() {
+		return key + ".<name>="
+	}
+	s, _ := v.text()
+	if s == "" {
+		return key + "="
+	}
+	if strings.ContainsAny(s, " #\"'\\$") {
+		s = strconv.Quote(s)
+	}
+	return key + "=" + s
+}
+
+// flowValue renders v in the inline syntax YAML and TOML share.
+func flowValue(v sampleValue) string {
+	if v.isMap() {
+		return "{}"
+	}
+	if elems, isString, ok := v.list(); ok {
+		out := make([]string, len(elems))
+		for i, e := range elems {
+			if isString {
+				e = strconv.Quote(e)
+			}
+			out[i] = e
+		}
+		return "[" + strings.Join(out, ", ") + "]"
+	}
+	s, isString := v.text()
+	if isString {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// sampleComment describes f: its doc tag, then required, secret, validate
+// rules, env var and flag in parentheses.
+func sampleComment(f configField, prefix string) string {
+	var meta []string
+	if f.field.Tag.Get("required") == "true" {
+		meta = append(meta, "required")
+	}
+	if f.field.Tag.Get("secret") == "true" {
+		meta = append(meta, "secret")
+	}
+	if rules := f.field.Tag.Get("validate"); rules != "" {
+		meta = append(meta, rules)
+	}
+	if prefix != "" {
+		meta = append(meta, "env "+envVarName(prefix, f.key))
+	}
+	if flag := f.field.Tag.Get("flag"); flag != "" {
+		meta = append(meta, "flag --"+flag)
+	}
+	doc := f.field.Tag.Get("doc")
+	switch {
+	case len(meta) == 0:
+		return doc
+	case doc == "":
+		return strings.Join(meta, ", ")
+	default:
+		return doc + " (" + strings.Join(meta, ", ") + ")"
+	}
+}
+
+func indent(depth int) string { return strings.Repeat("  ", depth) }
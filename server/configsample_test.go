@@ -0,0 +1,97 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sampleConfig struct {
+	ListenAddr string        `mapstructure:"listen_addr" flag:"listen-addr" doc:"address to listen on" default:":9000"`
+	Timeout    time.Duration `default:"5s"`
+	Port       int           `validate:"min=1,max=65535" default:"9000"`
+	Hosts      []string      `default:"a,b"`
+	Debug      bool
+	Key        []byte `secret:"true"`
+	Database   struct {
+		DSN  string `mapstructure:"dsn" doc:"connection string" default:"file:app.db"`
+		Pool struct {
+			Max int `default:"10"`
+		}
+		Type string `default:"sqlite"`
+	}
+	Name string
+}
+
+var uncomment = regexp.MustCompile(`(?m)^(\s*)#([^ ])`)
+
+// Every format lists all keys, and uncommented reads back as the defaults.
+func TestWriteSampleConfig(t *testing.T) {
+	for _, format := range []string{"yaml", "toml", "dotenv"} {
+		t.Run(format, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("SERVICE_NAME", "myapp")
+			t.Setenv("XDG_CONFIG_HOME", "")
+			t.Setenv("CONFIG_BASE_PATH", "")
+			t.Setenv("HOME", home)
+
+			var buf bytes.Buffer
+			if err := WriteSampleConfig(&buf, &sampleConfig{}, format); err != nil {
+				t.Fatal(err)
+			}
+			out := buf.String()
+			for _, want := range []string{
+				"# address to listen on (env MYAPP_LISTEN_ADDR, flag --listen-addr)",
+				"# min=1,max=65535, env MYAPP_PORT",
+				"# secret, env MYAPP_KEY",
+				"# connection string (env MYAPP_DATABASE_DSN)",
+			} {
+				if !strings.Contains(out, want) {
+					t.Errorf("want %q in\n%s", want, out)
+				}
+			}
+
+			ext := map[string]string{"yaml": "yaml", "toml": "toml", "dotenv": "env"}[format]
+			mustWrite(t, filepath.Join(home, ".config", "myapp."+ext), uncomment.ReplaceAllString(out, "$1$2"))
+			var fromFile, fromDefaults sampleConfig
+			if err := ReadInConfig(&fromFile); err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+			if err := os.Remove(filepath.Join(home, ".config", "myapp."+ext)); err != nil {
+				t.Fatal(err)
+			}
+			if err := ReadInConfig(&fromDefaults); err != nil {
+				t.Fatal(err)
+			}
+			fromFile.Key, fromDefaults.Key = nil, nil
+			if !reflect.DeepEqual(fromFile, fromDefaults) {
+				t.Errorf("uncommented sample: got %+v, want %+v", fromFile, fromDefaults)
+			}
+		})
+	}
+}
+
+func TestWriteSampleConfigUnknownFormat(t *testing.T) {
+	if err := WriteSampleConfig(&bytes.Buffer{}, &sampleConfig{}, "xml"); err == nil {
+		t.Fatal("want error")
+	}
+}
+
+// A struct that encloses itself is one key, sampled as an empty table.
+func TestWriteSampleConfigRecursiveType(t *testing.T) {
+	var cfg struct {
+		Root configNode `mapstructure:"root"`
+	}
+	var b bytes.Buffer
+	if err := WriteSampleConfig(&b, &cfg, "yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "#next: {}\n") {
+		t.Errorf("want next as empty table, got:\n%s", b.String())
+	}
+}
@@ -0,0 +1,432 @@
+package server
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is the subset of JSON Schema (draft 2020-12) that [ConfigSchema]
+// produces. Marshal it with encoding/json.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Type                 []string           `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"` // false or *Schema
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+}
+
+// Patterns of the strings the default decode hooks accept.
+const (
+	durationPattern  = `^[-+]?(0|([0-9]*(\.[0-9]*)?(ns|us|µs|μs|ms|s|m|h))+)$`
+	byteSizePattern  = `^([-+]?(0[xXoObB])?[0-9a-fA-F_]+|[0-9]+(\.[0-9]+)?\s*(?i:[kmgtp]i?b?|b))$`
+	secretRefPattern = `^(file:/|env:|enc:).+`
+	fileModePattern  = `^(0[xXoObB])?[0-9a-fA-F_]+$`
+)
+
+var (
+	int64Type    = reflect.TypeFor[int64]()
+	fileModeType = reflect.TypeFor[fs.FileMode]()
+)
+
+// ConfigSchema derives a JSON Schema for config files of rawVal, a pointer
+// to the struct passed to [ReadInConfig], for editor completion and CI
+// checks (see [ValidateFile]):
+//
+//	json.NewEncoder(os.Stdout).Encode(server.ConfigSchema(&cfg))
+//
+// Keys are the mapstructure names; unknown keys are rejected. Types follow
+// the default decode hooks: time.Duration is a duration string such as
+// "5s", int64 also a byte size such as "10MiB", fs.FileMode also a string
+// such as "0640", []byte a base64 string, and a slice also accepts a
+// comma-separated string. Types that decode from text, such as
+// time.Time, url.URL or netip.Prefix, are strings.
+// `doc:"…"` becomes the description, `default:"…"` the default, and the
+// validate rules oneof, min, max and url the matching keywords. Fields
+// tagged `secret:"true"` also take a file:/…, env:… or enc:… reference,
+// as ReadInConfig resolves those in such fields only.
+//
+// Required keys are not marked required: they may come from another file
+// or an env var.
+func ConfigSchema(rawVal any) *Schema {
+	t := reflect.TypeOf(rawVal)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return &Schema{Schema: "https://json-schema.org/draft/2020-12/schema"}
+	}
+	s := schemaOf(t, map[reflect.Type]bool{})
+	s.Schema = "https://json-schema.org/draft/2020-12/schema"
+	return s
+}
+
+// schemaOf returns the schema of t; path holds the config struct types
+// enclosing it, so a recursive type ends in a schema that takes any value.
+func schemaOf(t reflect.Type, path map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == durationType:
+		return &Schema{Type: []string{"string", "integer"}, Pattern: durationPattern}
+	case t == int64Type:
+		// StringToByteSizeHookFunc
+		return &Schema{Type: []string{"integer", "string"}, Pattern: byteSizePattern}
+	case t == fileModeType:
+		return &Schema{Type: []string{"integer", "string"}, Pattern: fileModePattern}
+	case t == urlType:
+		return &Schema{Type: []string{"string"}, Format: "uri-reference"}
+	case isConfigStruct(t):
+		if path[t] {
+			return &Schema{}
+		}
+		s := &Schema{Type: []string{"object"}, Properties: map[string]*Schema{}, AdditionalProperties: false}
+		addProperties(s, t, path)
+		return s
+	case t.Kind() == reflect.Struct || t.Implements(textUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType):
+		return &Schema{Type: []string{"string"}}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return &Schema{Type: []string{"string"}, ContentEncoding: "base64"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return &Schema{AnyOf: []*Schema{
+			{Type: []string{"array"}, Items: schemaOf(t.Elem(), path)},
+			{Type: []string{"string"}, Description: "comma-separated list"},
+		}}
+	case t.Kind() == reflect.Map:
+		return &Schema{Type: []string{"object"}, AdditionalProperties: schemaOf(t.Elem(), path)}
+	case t.Kind() == reflect.Bool:
+		return &Schema{Type: []string{"boolean"}}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		return &Schema{Type: []string{"integer"}}
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uintptr:
+		return &Schema{Type: []string{"integer"}, Minimum: ptr(0.0)}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return &Schema{Type: []string{"number"}}
+	case t.Kind() == reflect.String:
+		return &Schema{Type: []string{"string"}}
+	default:
+		return &Schema{}
+	}
+}
+
+func addProperties(s *Schema, t reflect.Type, path map[reflect.Type]bool) {
+	path[t] = true
+	defer delete(path, t)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, squash, ok := configFieldName(f)
+		if !ok {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if squash && isConfigStruct(ft) {
+			if !path[ft] {
+				addProperties(s, ft, path)
+			}
+			continue
+		}
+		p := schemaOf(f.Type, path)
+		applyRules(p, ft, f.Tag.Get("validate"))
+		if f.Tag.Get("secret") == "true" {
+			p = allowSecretRef(p)
+		}
+		p.Description = f.Tag.Get("doc")
+		if def, ok := f.Tag.Lookup("default"); ok {
+			p.Default = schemaDefault(ft, def)
+		}
+		s.Properties[name] = p
+	}
+}
+
+// allowSecretRef lets the value of a `secret:"true"` field, or each of its
+// list elements, be a file:, env: or enc: reference instead, which
+// ReadInConfig resolves before decoding.
+func allowSecretRef(p *Schema) *Schema {
+	ref := &Schema{Type: []string{"string"}, Pattern: secretRefPattern}
+	if len(p.AnyOf) > 0 && p.AnyOf[0].Items != nil {
+		// The comma-separated form of a list takes any string already.
+		p.AnyOf[0].Items = &Schema{AnyOf: []*Schema{p.AnyOf[0].Items, ref}}
+		return p
+	}
+	return &Schema{AnyOf: []*Schema{p, ref}}
+}
+
+// schemaDefault converts a default tag to the JSON value of type t.
+func schemaDefault(t reflect.Type, def string) any {
+	switch {
+	case t == durationType:
+		return def
+	case t.Kind() == reflect.Bool:
+		if b, err := strconv.ParseBool(def); err == nil {
+			return b
+		}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Float64:
+		if n, err := strconv.ParseFloat(def, 64); err == nil {
+			return n
+		}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8:
+		if def == "" {
+			return []any{}
+		}
+		var elems []any
+		for _, e := range strings.Split(def, ",") {
+			elems = append(elems, schemaDefault(t.Elem(), e))
+		}
+		return elems
+	}
+	return def
+}
+
+// applyRules adds the keywords for the validate rules of a field that JSON
+// Schema can express.
+func applyRules(s *Schema, t reflect.Type, tag string) {
+	target := s
+	if len(s.AnyOf) > 0 {
+		target = s.AnyOf[0] // the array form of a slice
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "oneof":
+			for _, v := range strings.Fields(arg) {
+				s.Enum = append(s.Enum, schemaDefault(t, v))
+			}
+		case "url":
+			s.Format = "uri"
+		case "min", "max":
+			if t == durationType {
+				continue
+			}
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			switch {
+			case t.Kind() == reflect.String:
+				setBound(&target.MinLength, &target.MaxLength, name, int(n))
+			case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+				setBound(&target.MinItems, &target.MaxItems, name, int(n))
+			case t.Kind() >= reflect.Int && t.Kind() <= reflect.Float64:
+				setBound(&target.Minimum, &target.Maximum, name, n)
+			}
+		}
+	}
+}
+
+func setBound[N int | float64](minField, maxField **N, name string, n N) {
+	if name == "min" {
+		*minField = &n
+	} else {
+		*maxField = &n
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// ValidateFile checks the config file at path against [ConfigSchema] of
+// rawVal without decoding it, e.g. in CI. The format follows the extension
+// as in [ReadInConfig]. Like ReadInConfig, a string is accepted where a
+// number or boolean is expected when it parses as one, which is how all
+// dotenv values arrive. Every failure is reported in one
+// [*ValidationError].
+func ValidateFile(path string, rawVal any) error {
+	layers, err := parseConfigFiles([]string{path})
+	if err != nil {
+		return err
+	}
+	var errs []FieldError
+	ConfigSchema(rawVal).check(layers[0], "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: errs}
+}
+
+func (s *Schema) check(v any, key string, errs *[]FieldError) {
+	if v == nil {
+		return // an empty key leaves the value unset
+	}
+	if len(s.AnyOf) > 0 {
+		for _, alt := range s.AnyOf {
+			var altErrs []FieldError
+			alt.check(v, key, &altErrs)
+			if len(altErrs) == 0 {
+				return
+			}
+		}
+		var types []string
+		for _, alt := range s.AnyOf {
+			types = append(types, alt.Type...)
+		}
+		*errs = append(*errs, FieldError{Key: key, Msg: "must be " + strings.Join(types, " or ")})
+		return
+	}
+	if len(s.Type) > 0 && !slices.ContainsFunc(s.Type, func(t string) bool { return hasSchemaType(v, t) }) {
+		*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf("must be %s, got %v", strings.Join(s.Type, " or "), v)})
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(v) }) {
+		var want []string
+		for _, e := range s.Enum {
+			want = append(want, fmt.Sprint(e))
+		}
+		*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf("must be one of %s, got %v", strings.Join(want, ", "), v)})
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		s.checkObject(v, key, errs)
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf("must have at least %d items", *s.MinItems)})
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf("must have at most %d items", *s.MaxItems)})
+		}
+		if s.Items != nil {
+			for i, e := range v {
+				s.Items.check(e, fmt.Sprintf("%s[%d]", key, i), errs)
+			}
+		}
+	case string:
+		if n, ok := toNumber(v); ok && !slices.Contains(s.Type, "string") {
+			s.checkNumber(n, key, errs)
+			return
+		}
+		s.checkString(v, key, errs)
+	default:
+		if n, ok := toNumber(v); ok {
+			s.checkNumber(n, key, errs)
+		}
+		if slices.Equal(s.Type, []string{"string"}) {
+			// A number or boolean decodes into a string as its text.
+			s.checkString(fmt.Sprint(v), key, errs)
+		}
+	}
+}
+
+func (s *Schema) checkObject(m map[string]any, key string, errs *[]FieldError) {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	for _, k := range names {
+		if p, ok := s.Properties[k]; ok {
+			p.check(m[k], joinKey(key, k), errs)
+			continue
+		}
+		switch ap := s.AdditionalProperties.(type) {
+		case *Schema:
+			ap.check(m[k], joinKey(key, k), errs)
+		case bool:
+			if !ap && s.Properties != nil {
+				*errs = append(*errs, FieldError{Key: joinKey(key, k), Msg: "unknown key"})
+			}
+		}
+	}
+}
+
+func (s *Schema) checkString(v, key string, errs *[]FieldError) {
+	n := utf8.RuneCountInString(v)
+	if s.MinLength != nil && n < *s.MinLength {
+		*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf("must be at least %d long", *s.MinLength)})
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf("must be at most %d long", *s.MaxLength)})
+	}
+	if s.Pattern != "" {
+		if ok, _ := regexp.MatchString(s.Pattern, v); !ok {
+			*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf("invalid value %q", v)})
+		}
+	}
+	if s.Format == "uri" {
+		if u, err := url.Parse(v); err != nil || u.Scheme == "" || u.Host == "" {
+			*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf("must be an absolute URL, got %q", v)})
+		}
+	}
+}
+
+func (s *Schema) checkNumber(n float64, key string, errs *[]FieldError) {
+	if s.Minimum != nil && n < *s.Minimum {
+		*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf("must be at least %v", *s.Minimum)})
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		*errs = append(*errs, FieldError{Key: key, Msg: fmt.Sprintf("must be at most %v", *s.Maximum)})
+	}
+}
+
+// hasSchemaType reports whether v, as parsed from a config file, is of the
+// JSON Schema type t, accepting strings that parse as numbers or booleans.
+func hasSchemaType(v any, t string) bool {
+	switch t {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		switch v.(type) {
+		case map[string]any, []any:
+			return false
+		}
+		return true // scalars decode into strings
+	case "boolean":
+		switch v := v.(type) {
+		case bool:
+			return true
+		case string:
+			_, err := strconv.ParseBool(v)
+			return err == nil
+		}
+		return false
+	case "integer":
+		n, ok := toNumber(v)
+		return ok && n == float64(int64(n))
+	case "number":
+		_, ok := toNumber(v)
+		return ok
+	}
+	return true
+}
+
+func toNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
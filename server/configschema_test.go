@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaConfig struct {
+	ListenAddr string        `mapstructure:"listen_addr" doc:"address to listen on" default:":9000"`
+	Timeout    time.Duration `default:"5s"`
+	Port       int           `validate:"min=1,max=65535"`
+	Workers    uint
+	Ratio      float64
+	Debug      bool
+	Hosts      []string `default:"a,b" validate:"max=3"`
+	Key        []byte
+	Callback   string `validate:"url"`
+	Labels     map[string]int
+	Started    time.Time
+	Database   struct {
+		DSN  string `mapstructure:"dsn"`
+		Type string `validate:"oneof=sqlite mysql"`
+	}
+	SquashedConfig `mapstructure:",squash"`
+}
+
+func TestConfigSchema(t *testing.T) {
+	b, err := json.Marshal(ConfigSchema(&schemaConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	props := got["properties"].(map[string]any)
+	prop := func(name string) string {
+		b, _ := json.Marshal(props[name])
+		return string(b)
+	}
+	for name, want := range map[string]string{
+		"listen_addr": `{"default":":9000","description":"address to listen on","type":["string"]}`,
+		"timeout":     `"pattern":`,
+		"port":        `"maximum":65535,"minimum":1,"type":["integer"]`,
+		"workers":     `"minimum":0`,
+		"hosts":       `{"anyOf":[{"items":{"type":["string"]},"maxItems":3,"type":["array"]},{"description":"comma-separated list","type":["string"]}],"default":["a","b"]}`,
+		"key":         `"contentEncoding":"base64"`,
+		"callback":    `"format":"uri"`,
+		"labels":      `{"additionalProperties":{"type":["integer"]},"type":["object"]}`,
+		"started":     `{"type":["string"]}`,
+		"database":    `"type":{"enum":["sqlite","mysql"]`,
+		"http":        `"timeout":`,
+	} {
+		if !strings.Contains(prop(name), want) {
+			t.Errorf("%s: want %s in %s", name, want, prop(name))
+		}
+	}
+	if got["additionalProperties"] != false || got["$schema"] == nil {
+		t.Errorf("root: got %s", b)
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.yaml")
+	mustWrite(t, good, "listen_addr: :8080\ntimeout: 1m30s\nport: 8080\nhosts: a,b\nlabels:\n  x: 1\ndatabase:\n  type: mysql\nhttp:\n  timeout: 5s\n")
+	if err := ValidateFile(good, &schemaConfig{}); err != nil {
+		t.Errorf("good.yaml: %v", err)
+	}
+	env := filepath.Join(dir, "good.env")
+	mustWrite(t, env, "port=8080\ndebug=true\nratio=0.5\n")
+	if err := ValidateFile(env, &schemaConfig{}); err != nil {
+		t.Errorf("good.env: %v", err)
+	}
+
+	bad := filepath.Join(dir, "bad.toml")
+	mustWrite(t, bad, "timeout = \"5\"\nport = 70000\nworkers = -1\ndebug = \"maybe\"\nhosts = [\"a\", \"b\", \"c\", \"d\"]\ncallback = \"/cb\"\ntypo = 1\n\n[database]\ntype = \"postgres\"\n\n[labels]\nx = \"one\"\n")
+	err := ValidateFile(bad, &schemaConfig{})
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("want ValidationError, got %v", err)
+	}
+	for _, want := range []string{
+		`timeout: invalid value "5"`,
+		"port: must be at most 65535",
+		"workers: must be at least 0",
+		"debug: must be boolean",
+		"hosts: must be array or string",
+		"callback: must be an absolute URL",
+		"typo: unknown key",
+		"database.type: must be one of sqlite, mysql",
+		"labels.x: must be integer",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("want %q in %v", want, err)
+		}
+	}
+	if len(ve.Fields) != 9 {
+		t.Errorf("want 9 errors, got %d: %v", len(ve.Fields), err)
+	}
+}
+
+// Secret references validate where ReadInConfig resolves them: in fields
+// tagged secret, and nowhere else.
+func TestValidateFile_SecretRefs(t *testing.T) {
+	type secretConfig struct {
+		Port    int           `mapstructure:"port" secret:"true" validate:"max=65535"`
+		Timeout time.Duration `mapstructure:"timeout" secret:"true"`
+		Keys    []string      `mapstructure:"keys" secret:"true"`
+		Workers int           `mapstructure:"workers"`
+	}
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.yaml")
+	mustWrite(t, good, "port: env:PORT\ntimeout: file:/run/secrets/t\nkeys: [enc:AAAA, plain]\nworkers: 4\n")
+	if err := ValidateFile(good, &secretConfig{}); err != nil {
+		t.Errorf("good.yaml: %v", err)
+	}
+
+	bad := filepath.Join(dir, "bad.yaml")
+	mustWrite(t, bad, "port: 70000\nworkers: env:WORKERS\n")
+	err := ValidateFile(bad, &secretConfig{})
+	if err == nil || !strings.Contains(err.Error(), "port: must be integer or string") || !strings.Contains(err.Error(), "workers: must be integer") {
+		t.Fatalf("want port and workers errors, got %v", err)
+	}
+}
+
+// A struct that encloses itself accepts any value at the repeat.
+func TestValidateFile_RecursiveType(t *testing.T) {
+	var cfg struct {
+		Root configNode `mapstructure:"root"`
+	}
+	path := filepath.Join(t.TempDir(), "node.yaml")
+	mustWrite(t, path, "root:\n  name: a\n  next:\n    name: b\n    next: {name: c}\n")
+	if err := ValidateFile(path, &cfg); err != nil {
+		t.Error(err)
+	}
+}
@@ -16,11 +16,8 @@
 package server
 
 import (
-	"fmt"
-	"log"
-	"net"
+	"context"
 	"net/http"
-	"net/http/fcgi"
 	"os"
 
 	"github.com/sebatec-eu/config-mate/v2/core"
@@ -29,7 +26,9 @@ import (
 const defaultHttpPort = "9000"
 
 // ListenAndServe starts an HTTP server using either FastCGI or standard HTTP,
-// depending on the environment.
+// depending on the environment. It is [ListenAndServeContext] with a
+// background context and default options, so SIGINT/SIGTERM trigger a
+// graceful shutdown and a nil return.
 //
 // Precedence:
 //  1. FCGI_LISTEN env var → FastCGI on that address (lets Caddy
@@ -41,36 +40,57 @@ const defaultHttpPort = "9000"
 //  3. Otherwise plain HTTP on the address resolved by [listenAddr]:
 //     ADDR (e.g. "127.0.0.1:9000") → PORT (bare port, e.g. "8080") →
 //     default ":9000".
+//
+// In the HTTP branch, TLS_CERT_FILE and TLS_KEY_FILE switch the listener to
+// HTTPS. The pair is re-read when either file changes, so renewed
+// certificates are picked up without a restart. TLS_REDIRECT_ADDR (e.g.
+// ":80") additionally starts a listener that redirects every request to
+// HTTPS; it is ignored without a certificate.
+//
+// FCGI_LISTEN, ADDR and TLS_REDIRECT_ADDR accept "unix:/path/to.sock" for a
+// unix socket (file mode from [ServerConfig].SocketMode), "systemd" or
+// "systemd:<name>" for a socket passed by systemd socket activation, and
+// "fd:<n>" for an inherited listening descriptor. When systemd passed
+// sockets and neither ADDR nor PORT is set, the HTTP branch uses the first
+// one.
+//
+// ADMIN_ADDR starts a second listener with [NewAdminMux] for internal
+// endpoints. To run FastCGI and HTTP at the same time, use [Server].
 func ListenAndServe(handler http.Handler) error {
-	if addr := os.Getenv("FCGI_LISTEN"); addr != "" {
-		ln, err := net.Listen("tcp", addr)
-		if err != nil {
-			return fmt.Errorf("net.Listen failed for FCGI_LISTEN=%s: %v", addr, err)
-		}
-		if err := fcgi.Serve(ln, handler); err != nil {
-			return fmt.Errorf("fcgi.Serve failed on %s: %v", addr, err)
-		}
-		return nil
-	}
+	return ListenAndServeContext(context.Background(), handler)
+}
 
-	if core.IsFCGI() {
-		if err := fcgi.Serve(nil, handler); err != nil {
-			return fmt.Errorf("fcgi.Serve failed: %v", err)
+// ListenAndServeContext is the context-aware form of [ListenAndServe]. It
+// picks the serving mode with the same precedence and serves until ctx is
+// cancelled or the process receives SIGINT/SIGTERM. It then stops accepting
+// connections, waits up to the shutdown timeout (see [WithShutdownTimeout])
+// for in-flight requests to finish, and returns nil. Timeouts and limits
+// come from [ServerConfig] (see [WithServerConfig]).
+//
+// A listener failure is returned as an error. So is a shutdown that runs
+// out of time with requests still in flight.
+func ListenAndServeContext(ctx context.Context, handler http.Handler, opts ...Option) error {
+	s := &Server{Handler: handler, AdminAddr: os.Getenv("ADMIN_ADDR")}
+	switch {
+	case os.Getenv("FCGI_LISTEN") != "":
+		s.FCGIAddr = os.Getenv("FCGI_LISTEN")
+	case core.IsFCGI():
+		s.FCGIAddr = fdPrefix + "0"
+	default:
+		certFile, keyFile, err := tlsFiles()
+		if err != nil {
+			return err
 		}
-		return nil
+		s.HTTPAddr = listenAddr()
+		s.TLSCertFile, s.TLSKeyFile = certFile, keyFile
+		s.RedirectAddr = os.Getenv("TLS_REDIRECT_ADDR")
 	}
-
-	addr := listenAddr()
-	log.Printf("Server listening on %s\n", addr)
-	if err := http.ListenAndServe(addr, handler); err != nil {
-		return fmt.Errorf("http.ListenAndServe failed on %s: %v", addr, err)
-	}
-	return nil
+	return s.ListenAndServe(ctx, opts...)
 }
 
 // listenAddr resolves the listen address for the plain-HTTP branch.
-// ADDR → PORT → default ":9000". ADDR accepts any host:port string passed
-// through to http.ListenAndServe; PORT is a bare port number.
+// ADDR → PORT → systemd socket activation → default ":9000". ADDR accepts
+// any address understood by [listen]; PORT is a bare port number.
 func listenAddr() string {
 	if addr := os.Getenv("ADDR"); addr != "" {
 		return addr
@@ -78,5 +98,8 @@ func listenAddr() string {
 	if port := os.Getenv("PORT"); port != "" {
 		return ":" + port
 	}
+	if systemdActivated() {
+		return systemdPrefix
+	}
 	return ":" + defaultHttpPort
 }
@@ -4,39 +4,136 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/http"
+	"sync"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/httplog/v3"
 )
 
+type logAttrsKey struct{}
+
+// logAttrs collects log attributes. The holder of a request is shared by
+// every context derived from it, so attributes added by a handler also
+// reach loggers taken by the middleware around it.
+type logAttrs struct {
+	mu       sync.Mutex
+	request  bool
+	remoteIP string
+	attrs    []slog.Attr
+}
+
+// withLogAttrsHolder installs the attribute holder of a request served by
+// [RequestLoggerWithOptions].
+func withLogAttrsHolder(r *http.Request) *http.Request {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return r.WithContext(context.WithValue(r.Context(), logAttrsKey{}, &logAttrs{request: true, remoteIP: ip}))
+}
+
+// WithLogAttrs adds attrs to every record logged through [Logger] for ctx.
+// Within a request served by [RequestLogger] they are added to the request
+// itself and ctx is returned unchanged: middleware further out sees them
+// too, and they appear on the request log line. Elsewhere a derived
+// context is returned.
+func WithLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	h, _ := ctx.Value(logAttrsKey{}).(*logAttrs)
+	if h != nil && h.request {
+		h.mu.Lock()
+		h.attrs = append(h.attrs, attrs...)
+		h.mu.Unlock()
+		httplog.SetAttrs(ctx, attrs...)
+		return ctx
+	}
+	var parent []slog.Attr
+	if h != nil {
+		parent = h.attrs
+	}
+	return context.WithValue(ctx, logAttrsKey{}, &logAttrs{attrs: append(parent[:len(parent):len(parent)], attrs...)})
+}
+
+// WithUserID records the authenticated user as "userID", e.g. from an auth
+// middleware.
+func WithUserID(ctx context.Context, id string) context.Context {
+	return WithLogAttrs(ctx, slog.String("userID", id))
+}
+
+// Logger returns slog's default logger with the request attributes of ctx:
+// "requestID", the chi "route" pattern, "remoteIP", and everything added
+// through [WithLogAttrs]. Outside a request it is the default logger.
+func Logger(ctx context.Context) *slog.Logger {
+	var attrs []any
+	if rID := middleware.GetReqID(ctx); rID != "" {
+		attrs = append(attrs, slog.String("requestID", rID))
+	}
+	// The pattern is complete only once routing is done, so it is read here
+	// rather than when the request starts.
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if route := rctx.RoutePattern(); route != "" {
+			attrs = append(attrs, slog.String("route", route))
+		}
+	}
+	if h, ok := ctx.Value(logAttrsKey{}).(*logAttrs); ok {
+		h.mu.Lock()
+		if h.remoteIP != "" {
+			attrs = append(attrs, slog.String("remoteIP", h.remoteIP))
+		}
+		for _, a := range h.attrs {
+			attrs = append(attrs, a)
+		}
+		h.mu.Unlock()
+	}
+	if len(attrs) == 0 {
+		return slog.Default()
+	}
+	return slog.Default().With(attrs...)
+}
+
+// LogDebugKV logs msg at debug level with key-value pairs args, like
+// [slog.Logger.DebugContext], through [Logger].
+func LogDebugKV(ctx context.Context, msg string, args ...any) {
+	Logger(ctx).DebugContext(ctx, msg, args...)
+}
+
+// LogInfoKV logs msg at info level with key-value pairs args.
+func LogInfoKV(ctx context.Context, msg string, args ...any) {
+	Logger(ctx).InfoContext(ctx, msg, args...)
+}
+
+// LogWarnKV logs msg at warning level with key-value pairs args.
+func LogWarnKV(ctx context.Context, msg string, args ...any) {
+	Logger(ctx).WarnContext(ctx, msg, args...)
+}
+
+// LogErrorKV logs msg at error level with key-value pairs args.
+func LogErrorKV(ctx context.Context, msg string, args ...any) {
+	Logger(ctx).ErrorContext(ctx, msg, args...)
+}
+
+// LogDebug logs a debug-level message with the request context.
+// The record carries the request attributes described at [Logger].
+func LogDebug(ctx context.Context, format string, args ...any) {
+	Logger(ctx).DebugContext(ctx, fmt.Sprintf(format, args...))
+}
+
 // LogInfo logs an information-level message with the request context.
-// If a request ID is present in the context, it is included in the log record.
+// The record carries the request attributes described at [Logger].
 func LogInfo(ctx context.Context, format string, args ...any) {
-	rID := middleware.GetReqID(ctx)
-	if rID != "" {
-		slog.InfoContext(ctx, fmt.Sprintf(format, args...), "requestID", middleware.GetReqID(ctx))
-	} else {
-		slog.InfoContext(ctx, fmt.Sprintf(format, args...))
-	}
+	Logger(ctx).InfoContext(ctx, fmt.Sprintf(format, args...))
 }
 
 // LogWarn logs a warning-level message with the request context.
-// If a request ID is present in the context, it is included in the log record.
+// The record carries the request attributes described at [Logger].
 func LogWarn(ctx context.Context, format string, args ...any) {
-	rID := middleware.GetReqID(ctx)
-	if rID != "" {
-		slog.WarnContext(ctx, fmt.Sprintf(format, args...), "requestID", middleware.GetReqID(ctx))
-	} else {
-		slog.WarnContext(ctx, fmt.Sprintf(format, args...))
-	}
+	Logger(ctx).WarnContext(ctx, fmt.Sprintf(format, args...))
 }
 
 // LogError logs an error-level message with the request context.
-// If a request ID is present in the context, it is included in the log record.
+// The record carries the request attributes described at [Logger].
 func LogError(ctx context.Context, format string, args ...any) {
-	rID := middleware.GetReqID(ctx)
-	if rID != "" {
-		slog.ErrorContext(ctx, fmt.Sprintf(format, args...), "requestID", middleware.GetReqID(ctx))
-	} else {
-		slog.ErrorContext(ctx, fmt.Sprintf(format, args...))
-	}
+	Logger(ctx).ErrorContext(ctx, fmt.Sprintf(format, args...))
 }
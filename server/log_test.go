@@ -3,8 +3,12 @@ package server
 import (
 	"context"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
@@ -73,3 +77,61 @@ func contains(s, sub string) bool {
 	}
 	return false
 }
+
+// Logger carries route, remote IP and the attributes added by middleware
+// and handlers; the request log line gets the added attributes too.
+func TestLoggerRequestAttrs(t *testing.T) {
+	logFile := setupLogTest(t)
+	mw, err := RequestLoggerWithOptions(LogConfig{Output: "file", File: logFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID, mw, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithUserID(r.Context(), "u-7")))
+		})
+	})
+	r.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		WithLogAttrs(r.Context(), slog.String("item", chi.URLParam(r, "id")))
+		LogInfoKV(r.Context(), "loaded", "count", 3)
+	})
+	req := httptest.NewRequest("GET", "/items/42", nil)
+	req.RemoteAddr = "192.0.2.1:4711"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(readFile(t, logFile)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want handler and request line, got %q", lines)
+	}
+	for _, w := range []string{`"msg":"loaded"`, `"count":3`, `"requestID":"`, `"route":"/items/{id}"`,
+		`"remoteIP":"192.0.2.1"`, `"userID":"u-7"`, `"item":"42"`} {
+		if !strings.Contains(lines[0], w) {
+			t.Errorf("handler line: want %s in %s", w, lines[0])
+		}
+	}
+	for _, w := range []string{`"userID":"u-7"`, `"item":"42"`} {
+		if !strings.Contains(lines[1], w) {
+			t.Errorf("request line: want %s in %s", w, lines[1])
+		}
+	}
+}
+
+// Outside a request WithLogAttrs derives a context and leaves the parent
+// alone.
+func TestWithLogAttrsOutsideRequest(t *testing.T) {
+	rec := &recorder{}
+	orig := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(orig) })
+	slog.SetDefault(slog.New(slog.NewJSONHandler(rec, nil)))
+
+	parent := WithLogAttrs(context.Background(), slog.String("job", "sync"))
+	child := WithLogAttrs(parent, slog.Int("batch", 2))
+	LogInfo(parent, "parent")
+	LogInfo(child, "child")
+
+	if len(rec.lines) != 2 || contains(rec.lines[0], `"batch"`) || !contains(rec.lines[1], `"job":"sync","batch":2`) {
+		t.Fatalf("got %q", rec.lines)
+	}
+}
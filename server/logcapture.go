@@ -0,0 +1,309 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/httplog/v3"
+)
+
+// redacted replaces the value of a redacted header or field.
+const redacted = "[REDACTED]"
+
+// defaultRedactHeaders and defaultRedactFields are always redacted; the
+// lists in LogCaptureConfig add to them.
+var (
+	defaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+	defaultRedactFields  = []string{"password", "*token*", "*secret*"}
+)
+
+// defaultCaptureContentTypes are the types whose bodies can be redacted.
+var defaultCaptureContentTypes = []string{
+	"application/json",
+	"application/problem+json",
+	"application/x-www-form-urlencoded",
+}
+
+const (
+	defaultCaptureMaxBytes = 1024
+
+	// redactLimit is the largest JSON or form body that is parsed for
+	// redaction; larger ones are not logged at all.
+	redactLimit = 64 << 10
+)
+
+// LogCaptureConfig adds request and response headers and bodies to the
+// request log line of [RequestLoggerWithOptions], for debugging in dev or
+// staging. Everything is off by default.
+//
+// Headers named in RedactHeaders and JSON or form fields matching
+// RedactFields are logged as "[REDACTED]".
+type LogCaptureConfig struct {
+	// RequestBody and ResponseBody log the bodies whose Content-Type starts
+	// with one of ContentTypes, cut to MaxBytes.
+	RequestBody  bool `mapstructure:"request_body"`
+	ResponseBody bool `mapstructure:"response_body"`
+
+	// MaxBytes is the logged length of a body; default 1024.
+	MaxBytes int `mapstructure:"max_bytes"`
+
+	// ContentTypes defaults to JSON and form bodies, the ones redacted.
+	// Other types, e.g. text/plain, are logged only when listed here, and
+	// then as they are, without redaction.
+	ContentTypes []string `mapstructure:"content_types"`
+
+	// RequestHeaders and ResponseHeaders name the headers to log.
+	RequestHeaders  []string `mapstructure:"request_headers"`
+	ResponseHeaders []string `mapstructure:"response_headers"`
+
+	// RedactHeaders are header names redacted in addition to
+	// Authorization, Proxy-Authorization, Cookie and Set-Cookie.
+	RedactHeaders []string `mapstructure:"redact_headers"`
+
+	// RedactFields are field names or path.Match patterns, matched case
+	// insensitively at any depth, redacted in addition to password,
+	// *token* and *secret*.
+	RedactFields []string `mapstructure:"redact_fields"`
+}
+
+func (c LogCaptureConfig) enabled() bool {
+	return c.RequestBody || c.ResponseBody || len(c.RequestHeaders) > 0 || len(c.ResponseHeaders) > 0
+}
+
+func (c LogCaptureConfig) validate() error {
+	for _, p := range c.RedactFields {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid redact field pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// capture returns the middleware that records the configured headers and
+// bodies for the request log line. It runs inside httplog's middleware and
+// hands the attributes over through httplog.SetAttrs.
+func (c LogCaptureConfig) capture(schema *httplog.Schema) func(http.Handler) http.Handler {
+	if !c.enabled() {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	r := newRedactor(c)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			var reqBody, respBody *limitedBuffer
+			if c.RequestBody && req.Body != nil && req.Body != http.NoBody && r.loggable(req.Header) {
+				reqBody = &limitedBuffer{limit: r.captureLimit}
+				req.Body = &teeBody{req.Body, reqBody}
+			}
+			ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+			if c.ResponseBody {
+				respBody = &limitedBuffer{limit: r.captureLimit}
+				ww.Tee(respBody)
+			}
+
+			defer func() {
+				var attrs []slog.Attr
+				if len(c.RequestHeaders) > 0 {
+					attrs = append(attrs, slog.Any(schema.RequestHeaders, r.headers(req.Header, c.RequestHeaders)))
+				}
+				if len(c.ResponseHeaders) > 0 {
+					attrs = append(attrs, slog.Any(schema.ResponseHeaders, r.headers(ww.Header(), c.ResponseHeaders)))
+				}
+				if reqBody != nil {
+					attrs = append(attrs, slog.String(schema.RequestBody, r.body(reqBody, req.Header.Get("Content-Type"))))
+				}
+				if respBody != nil && r.loggable(ww.Header()) {
+					attrs = append(attrs, slog.String(schema.ResponseBody, r.body(respBody, ww.Header().Get("Content-Type"))))
+				}
+				httplog.SetAttrs(req.Context(), attrs...)
+			}()
+			next.ServeHTTP(ww, req)
+		})
+	}
+}
+
+type redactor struct {
+	maxBytes      int
+	captureLimit  int
+	contentTypes  []string
+	redactHeaders map[string]bool
+	fields        []string
+}
+
+func newRedactor(c LogCaptureConfig) *redactor {
+	r := &redactor{
+		maxBytes:      c.MaxBytes,
+		contentTypes:  c.ContentTypes,
+		redactHeaders: map[string]bool{},
+	}
+	if r.maxBytes <= 0 {
+		r.maxBytes = defaultCaptureMaxBytes
+	}
+	r.captureLimit = max(r.maxBytes, redactLimit)
+	if r.contentTypes == nil {
+		r.contentTypes = defaultCaptureContentTypes
+	}
+	for _, h := range append(defaultRedactHeaders, c.RedactHeaders...) {
+		r.redactHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+	for _, f := range append(defaultRedactFields, c.RedactFields...) {
+		r.fields = append(r.fields, strings.ToLower(f))
+	}
+	return r
+}
+
+// loggable reports whether a body with the Content-Type of h is logged.
+func (r *redactor) loggable(h http.Header) bool {
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		return false
+	}
+	for _, allowed := range r.contentTypes {
+		if strings.HasPrefix(ct, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) headers(h http.Header, names []string) slog.Value {
+	attrs := make([]slog.Attr, 0, len(names))
+	for _, name := range names {
+		vals := h.Values(name)
+		switch {
+		case len(vals) == 0:
+		case r.redactHeaders[http.CanonicalHeaderKey(name)]:
+			attrs = append(attrs, slog.String(name, redacted))
+		case len(vals) == 1:
+			attrs = append(attrs, slog.String(name, vals[0]))
+		default:
+			attrs = append(attrs, slog.Any(name, vals))
+		}
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (r *redactor) field(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range r.fields {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// body returns the captured body for the log, redacted and cut to
+// maxBytes. JSON and form bodies that cannot be parsed are not logged, as
+// they cannot be redacted.
+func (r *redactor) body(b *limitedBuffer, contentType string) string {
+	if b.n == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	isJSON := mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	isForm := mediaType == "application/x-www-form-urlencoded"
+
+	s := b.buf.String()
+	if isJSON || isForm {
+		if b.n > int64(b.limit) {
+			return fmt.Sprintf("[body of %d bytes too large to redact]", b.n)
+		}
+		var err error
+		if isJSON {
+			s, err = r.json(b.buf.Bytes())
+		} else {
+			s, err = r.form(s)
+		}
+		if err != nil {
+			return "[body not logged: " + err.Error() + "]"
+		}
+	}
+	if len(s) > r.maxBytes || b.n > int64(b.buf.Len()) {
+		return s[:min(len(s), r.maxBytes)] + "... [trimmed]"
+	}
+	return s
+}
+
+func (r *redactor) json(b []byte) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", errors.New("invalid JSON")
+	}
+	out, err := json.Marshal(r.redactValue(v))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (r *redactor) redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if r.field(k) {
+				v[k] = redacted
+			} else {
+				v[k] = r.redactValue(e)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = r.redactValue(e)
+		}
+	}
+	return v
+}
+
+func (r *redactor) form(s string) (string, error) {
+	q, err := url.ParseQuery(s)
+	if err != nil {
+		return "", errors.New("invalid form")
+	}
+	for k := range q {
+		if r.field(k) {
+			q[k] = []string{redacted}
+		}
+	}
+	return q.Encode(), nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and counts the
+// rest. Writes never fail.
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+	n     int64
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.n += int64(len(p))
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// teeBody copies what the handler reads from a request body into buf.
+type teeBody struct {
+	io.ReadCloser
+	buf *limitedBuffer
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.buf.Write(p[:n])
+	return n, err
+}
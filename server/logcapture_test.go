@@ -0,0 +1,119 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogCapture(t *testing.T) {
+	logFile := setupLogTest(t)
+	mw, err := RequestLoggerWithOptions(LogConfig{
+		Schema: "standard",
+		Output: "file",
+		File:   logFile,
+		Capture: LogCaptureConfig{
+			RequestBody:     true,
+			ResponseBody:    true,
+			RequestHeaders:  []string{"Authorization", "X-Api-Key", "Origin"},
+			ResponseHeaders: []string{"Set-Cookie", "Content-Type"},
+			RedactHeaders:   []string{"X-Api-Key"},
+			RedactFields:    []string{"iban"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=abc")
+		io.WriteString(w, `{"user":{"name":"ann","accessToken":"t0k"},"items":[{"IBAN":"DE00"}]}`)
+	}))
+	req := httptest.NewRequest("POST", "/login", strings.NewReader("user=ann&password=hunter2"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Api-Key", "k3y")
+	req.Header.Set("Origin", "https://example.com")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := readFile(t, logFile)
+	for _, w := range []string{
+		`"request_headers":{"Authorization":"[REDACTED]","X-Api-Key":"[REDACTED]","Origin":"https://example.com"}`,
+		`"response_headers":{"Set-Cookie":"[REDACTED]","Content-Type":"application/json"}`,
+		`"request_body":"password=%5BREDACTED%5D&user=ann"`,
+		`"response_body":"{\"items\":[{\"IBAN\":\"[REDACTED]\"}],\"user\":{\"accessToken\":\"[REDACTED]\",\"name\":\"ann\"}}"`,
+	} {
+		if !strings.Contains(out, w) {
+			t.Errorf("want %s in %s", w, out)
+		}
+	}
+	for _, secret := range []string{"hunter2", "Bearer", "k3y", "abc", "t0k", "DE00"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%s leaked into %s", secret, out)
+		}
+	}
+}
+
+func TestRedactorBody(t *testing.T) {
+	r := newRedactor(LogCaptureConfig{MaxBytes: 8})
+	for _, tc := range []struct {
+		name, contentType, body string
+		limit                   int
+		want                    string
+	}{
+		{"plain text is trimmed", "text/plain", "hello world", 64, "hello wo... [trimmed]"},
+		{"redacted JSON is trimmed", "application/json", `{"a":1,"b":2}`, 64, `{"a":1,"... [trimmed]`},
+		{"invalid JSON", "application/json", `{"password":`, 64, "[body not logged: invalid JSON]"},
+		{"JSON beyond capture", "application/json", `{"a":"long"}`, 4, "[body of 12 bytes too large to redact]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &limitedBuffer{limit: tc.limit}
+			io.WriteString(b, tc.body)
+			if got := r.body(b, tc.contentType); got != tc.want {
+				t.Fatalf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+// By default only bodies that can be redacted are logged.
+func TestLogCaptureDefaultSkipsUnredactable(t *testing.T) {
+	logFile := setupLogTest(t)
+	mw, err := RequestLoggerWithOptions(LogConfig{
+		Schema:  "standard",
+		Output:  "file",
+		File:    logFile,
+		Capture: LogCaptureConfig{RequestBody: true, ResponseBody: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, "token=t0k")
+	}))
+	req := httptest.NewRequest("POST", "/login", strings.NewReader("<login><password>hunter2</password></login>"))
+	req.Header.Set("Content-Type", "application/xml")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	out := readFile(t, logFile)
+	if !strings.Contains(out, `"/login"`) {
+		t.Fatalf("request not logged: %s", out)
+	}
+	for _, secret := range []string{"hunter2", "t0k"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%s leaked into %s", secret, out)
+		}
+	}
+}
+
+func TestLogCaptureInvalidPattern(t *testing.T) {
+	setupLogTest(t)
+	if _, err := RequestLoggerWithOptions(LogConfig{Capture: LogCaptureConfig{RedactFields: []string{"[x"}}}); err == nil {
+		t.Fatal("want error for a malformed pattern")
+	}
+}
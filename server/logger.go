@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httplog/v3"
@@ -13,9 +14,148 @@ import (
 	"github.com/sebatec-eu/config-mate/v2/hostsharing"
 )
 
+// LogConfig selects level, format, schema and destination of the logger
+// installed by [RequestLoggerWithOptions]. The zero value reproduces
+// [RequestLogger]. It can be decoded through [ReadInConfig], e.g. under a
+// "log" key.
+type LogConfig struct {
+	// Level is debug, info (default), warn or error. The LOG_LEVEL env var
+	// overrides it; [SetLogLevel] changes it at runtime.
+	Level string `mapstructure:"level"`
+
+	// Format is json (default) or text.
+	Format string `mapstructure:"format"`
+
+	// Schema names the request log fields: gcp (default), ecs, otel or
+	// standard. An explicit schema also renames the time, level and message
+	// keys; the default keeps slog's time/level/msg keys as before.
+	Schema string `mapstructure:"schema"`
+
+	// Output is stdout, file or both. Empty picks the per-domain log file
+	// under Hostsharing FastCGI and stdout otherwise.
+	Output string `mapstructure:"output"`
+
+	// File is the log file for the file and both outputs. Empty means the
+	// Hostsharing per-domain log file (see hostsharing.FcgiLogFile).
+	File string `mapstructure:"file"`
+
+	// Rotate rotates that log file by size or age. The file is reopened
+	// on SIGHUP either way, for an external logrotate.
+	Rotate LogRotateConfig `mapstructure:"rotate"`
+
+	// Skip selects requests that are not logged, by default static assets.
+	Skip LogSkipConfig `mapstructure:"skip"`
+
+	// Capture adds redacted headers and bodies to the request log line.
+	Capture LogCaptureConfig `mapstructure:"capture"`
+}
+
+// logLevel is shared by every logger built here, so [SetLogLevel] takes
+// effect without rebuilding the middleware.
+var logLevel = new(slog.LevelVar)
+
+// SetLogLevel changes the level of the loggers installed by
+// [RequestLogger] and [RequestLoggerWithOptions] at runtime.
+func SetLogLevel(l slog.Level) {
+	logLevel.Set(l)
+}
+
+// LogLevel returns the current level set by [RequestLoggerWithOptions] or
+// [SetLogLevel].
+func LogLevel() slog.Level {
+	return logLevel.Level()
+}
+
+// LogLevelHandler reports the current level on GET and sets it from the
+// request body (e.g. "debug") on PUT or POST. Mount it on the admin
+// listener only.
+func LogLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut, http.MethodPost:
+			b, err := io.ReadAll(io.LimitReader(r.Body, 64))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			var l slog.Level
+			if err := l.UnmarshalText([]byte(strings.TrimSpace(string(b)))); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			SetLogLevel(l)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, LogLevel())
+	})
+}
+
+// schemaStandard logs request fields under plain names and leaves slog's
+// own keys alone.
+var schemaStandard = &httplog.Schema{
+	ErrorMessage:       "error",
+	ErrorType:          "error_type",
+	ErrorStackTrace:    "stack_trace",
+	RequestURL:         "url",
+	RequestMethod:      "method",
+	RequestPath:        "path",
+	RequestRemoteIP:    "remote_ip",
+	RequestHost:        "host",
+	RequestScheme:      "scheme",
+	RequestProto:       "proto",
+	RequestHeaders:     "request_headers",
+	RequestBody:        "request_body",
+	RequestBytes:       "request_bytes",
+	RequestBytesUnread: "request_bytes_unread",
+	RequestUserAgent:   "user_agent",
+	RequestReferer:     "referer",
+	ResponseHeaders:    "response_headers",
+	ResponseBody:       "response_body",
+	ResponseStatus:     "status",
+	ResponseDuration:   "duration_ms",
+	ResponseBytes:      "response_bytes",
+}
+
+func logSchema(name string) (*httplog.Schema, error) {
+	switch strings.ToLower(name) {
+	case "", "gcp":
+		return httplog.SchemaGCP, nil
+	case "ecs":
+		return httplog.SchemaECS, nil
+	case "otel":
+		return httplog.SchemaOTEL, nil
+	case "standard":
+		return schemaStandard, nil
+	default:
+		return nil, fmt.Errorf("unknown log schema %q (want gcp, ecs, otel or standard)", name)
+	}
+}
+
+// fcgiLogFile resolves the Hostsharing per-domain log file, or "".
+func fcgiLogFile() string {
+	exePath, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	logFile, err := hostsharing.FcgiLogFile(exePath)
+	if err != nil {
+		return ""
+	}
+	return logFile
+}
+
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+}
+
 // logWriter returns the io.Writer that RequestLogger should write to.
 //
-// Precedence:
+// With an empty c.Output:
 //  1. When core.IsFCGI() is true, the executable sits under a fastcgi/
 //     parent directory (Hostsharing Apache alias). We resolve the per-domain
 //     log file via hostsharing.FcgiLogFile. If that fails or the file
@@ -23,57 +163,135 @@ import (
 //     request.
 //  2. Otherwise stdout — the right default for local dev, CI, and VM
 //     deployments where stdout is collected by the orchestrator.
-func logWriter() io.Writer {
-	if !core.IsFCGI() {
-		return os.Stdout
-	}
-	exePath, err := os.Executable()
-	if err != nil {
-		return os.Stdout
+//
+// An explicit "file" or "both" output fails instead of falling back.
+func logWriter(c LogConfig) (io.Writer, error) {
+	switch strings.ToLower(c.Output) {
+	case "":
+		if !core.IsFCGI() {
+			return os.Stdout, nil
+		}
+		logFile := fcgiLogFile()
+		if logFile == "" {
+			return os.Stdout, nil
+		}
+		f, err := sharedLogFile(logFile, c.Rotate)
+		if err != nil {
+			return os.Stdout, nil
+		}
+		return f, nil
+	case "stdout":
+		return os.Stdout, nil
+	case "file", "both":
+		logFile := c.File
+		if logFile == "" {
+			logFile = fcgiLogFile()
+		}
+		if logFile == "" {
+			return nil, fmt.Errorf("log output %q needs a log file: set File or run under Hostsharing", c.Output)
+		}
+		f, err := sharedLogFile(logFile, c.Rotate)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open log file: %w", err)
+		}
+		if strings.EqualFold(c.Output, "both") {
+			return io.MultiWriter(os.Stdout, f), nil
+		}
+		return f, nil
+	default:
+		return nil, fmt.Errorf("unknown log output %q (want stdout, file or both)", c.Output)
 	}
-	logFile, err := hostsharing.FcgiLogFile(exePath)
-	if err != nil || logFile == "" {
-		return os.Stdout
+}
+
+// newLogHandler builds the slog.Handler for c writing to w. Records
+// logged with a traced context carry its trace and span ID.
+func newLogHandler(c LogConfig, w io.Writer, schema *httplog.Schema) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: logLevel}
+	if c.Schema != "" {
+		opts.ReplaceAttr = schema.ReplaceAttr
 	}
-	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
-	if err != nil {
-		return os.Stdout
+	var h slog.Handler
+	switch strings.ToLower(c.Format) {
+	case "", "json":
+		h = slog.NewJSONHandler(w, opts)
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want json or text)", c.Format)
 	}
-	return f
+	return &traceHandler{h, logTraceKeys(c.Schema)}, nil
 }
 
 // RequestLogger returns an HTTP middleware that logs requests using structured logging.
 // It sets up a JSON logger configured for Google Cloud Logging schema,
 // and logs request/response details including optional requestID from the request context.
-// Certain static asset types (css, js, fonts, etc.) are excluded from logging.
+// Static assets (css, js, fonts, etc.) are excluded from logging; see
+// [LogSkipConfig].
+//
+// It is [RequestLoggerWithOptions] with a zero [LogConfig] and panics when
+// the logger cannot be set up.
 func RequestLogger() func(next http.Handler) http.Handler {
+	mw, err := RequestLoggerWithOptions(LogConfig{})
+	if err != nil {
+		panic(fmt.Errorf("cannot set up request logger: %w", err))
+	}
+	return mw
+}
+
+// RequestLoggerWithOptions is [RequestLogger] with level, format, schema and
+// destination taken from c. Like RequestLogger it installs the logger as
+// slog's default, so [Logger], [LogInfo] and friends write to the same
+// destination, and gives every request the holder behind [WithLogAttrs].
+func RequestLoggerWithOptions(c LogConfig) (func(next http.Handler) http.Handler, error) {
 	serviceName, err := core.ServiceName()
 	if err != nil {
-		panic(fmt.Errorf("cannot detect environemnt: %e", err))
+		return nil, fmt.Errorf("cannot detect environment: %w", err)
 	}
 
-	logger := slog.New(slog.NewJSONHandler(logWriter(), &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	})).With(
+	level := c.Level
+	if env := os.Getenv("LOG_LEVEL"); env != "" {
+		level = env
+	}
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level: %w", err)
+		}
+	}
+	if err := c.Skip.validate(); err != nil {
+		return nil, err
+	}
+	if err := c.Capture.validate(); err != nil {
+		return nil, err
+	}
+	schema, err := logSchema(c.Schema)
+	if err != nil {
+		return nil, err
+	}
+	w, err := logWriter(c)
+	if err != nil {
+		return nil, err
+	}
+	h, err := newLogHandler(c, w, schema)
+	if err != nil {
+		return nil, err
+	}
+	SetLogLevel(l)
+
+	logger := slog.New(h).With(
 		slog.String("service", serviceName),
-		slog.String("version", "latest"),
+		slog.String("version", core.BuildInfo().Version),
 	)
 
 	slog.SetDefault(logger)
 
-	return httplog.RequestLogger(logger, &httplog.Options{
-		Level:         slog.LevelInfo,
+	requestLogger := httplog.RequestLogger(logger, &httplog.Options{
+		// The handler's level (logLevel) decides; httplog must not filter
+		// on its own or SetLogLevel(slog.LevelDebug) would have no effect.
+		Level:         slog.LevelDebug,
 		RecoverPanics: true,
-		Schema:        httplog.SchemaGCP,
-		Skip: func(r *http.Request, respStatus int) bool {
-			urlFormat, _ := r.Context().Value(middleware.URLFormatCtxKey).(string)
-			switch urlFormat {
-			case "css", "js", "woff2", "ico", "wasm", "svg", "json":
-				return true
-			default:
-				return false
-			}
-		},
+		Schema:        schema,
+		Skip:          c.Skip.skip,
 		LogExtraAttrs: func(r *http.Request, reqBody string, respStatus int) []slog.Attr {
 			attrs := []slog.Attr{}
 			rID := middleware.GetReqID(r.Context())
@@ -83,4 +301,11 @@ func RequestLogger() func(next http.Handler) http.Handler {
 			return attrs
 		},
 	})
+	capture := c.Capture.capture(schema)
+	return func(next http.Handler) http.Handler {
+		h := requestLogger(capture(next))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, withLogAttrsHolder(r))
+		})
+	}, nil
 }
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRequestLoggerWithOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		cfg    LogConfig
+		want   []string
+		reject []string
+	}{
+		{"default keeps historical keys", LogConfig{},
+			[]string{`"level":"INFO"`, `"httpRequest":{`, `"service":"myapp"`}, []string{`"severity"`}},
+		{"gcp schema renames slog keys", LogConfig{Schema: "gcp"},
+			[]string{`"severity":"INFO"`, `"httpRequest":{`}, []string{`"level"`}},
+		{"ecs schema", LogConfig{Schema: "ecs"},
+			[]string{`"log.level":"INFO"`, `"http.request.method":"GET"`}, nil},
+		{"standard schema", LogConfig{Schema: "standard"},
+			[]string{`"level":"INFO"`, `"method":"GET"`, `"status":200`}, nil},
+		{"text format", LogConfig{Format: "text", Schema: "standard"},
+			[]string{`level=INFO`, `method=GET`}, []string{`{`}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			logFile := setupLogTest(t)
+			tc.cfg.Output, tc.cfg.File = "file", logFile
+
+			serveThrough(t, tc.cfg, "/hello")
+
+			out := readFile(t, logFile)
+			for _, w := range tc.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("want %s in %s", w, out)
+				}
+			}
+			for _, r := range tc.reject {
+				if strings.Contains(out, r) {
+					t.Errorf("did not want %s in %s", r, out)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestLoggerWithOptionsErrors(t *testing.T) {
+	setupLogTest(t)
+	for _, cfg := range []LogConfig{
+		{Level: "loud"},
+		{Format: "xml"},
+		{Schema: "syslog"},
+		{Output: "printer"},
+		{Output: "file", File: filepath.Join(t.TempDir(), "missing", "app.log")},
+	} {
+		if _, err := RequestLoggerWithOptions(cfg); err == nil {
+			t.Errorf("%+v: want error", cfg)
+		}
+	}
+}
+
+// LOG_LEVEL overrides the configured level, and SetLogLevel changes it
+// without rebuilding the middleware.
+func TestLogLevelAtRuntime(t *testing.T) {
+	logFile := setupLogTest(t)
+	t.Setenv("LOG_LEVEL", "warn")
+
+	mw, err := RequestLoggerWithOptions(LogConfig{Level: "debug", Output: "file", File: logFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if LogLevel() != slog.LevelWarn {
+		t.Fatalf("LOG_LEVEL must win, got %v", LogLevel())
+	}
+	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/quiet", nil))
+	SetLogLevel(slog.LevelInfo)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/loud", nil))
+
+	out := readFile(t, logFile)
+	if strings.Contains(out, "/quiet") || !strings.Contains(out, "/loud") {
+		t.Fatalf("level change not applied: %s", out)
+	}
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	orig := LogLevel()
+	t.Cleanup(func() { SetLogLevel(orig) })
+
+	rec := httptest.NewRecorder()
+	LogLevelHandler().ServeHTTP(rec, httptest.NewRequest("PUT", "/", strings.NewReader("debug\n")))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "DEBUG" || LogLevel() != slog.LevelDebug {
+		t.Fatalf("PUT debug: got %d %q, level %v", rec.Code, rec.Body.String(), LogLevel())
+	}
+
+	rec = httptest.NewRecorder()
+	LogLevelHandler().ServeHTTP(rec, httptest.NewRequest("PUT", "/", strings.NewReader("loud")))
+	if rec.Code != http.StatusBadRequest || LogLevel() != slog.LevelDebug {
+		t.Fatalf("PUT loud: want 400 and unchanged level, got %d, %v", rec.Code, LogLevel())
+	}
+}
+
+// setupLogTest pins the service name and restores the global logger and
+// level afterwards. It returns a fresh log file path.
+func setupLogTest(t *testing.T) string {
+	t.Helper()
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("LOG_LEVEL", "")
+	origLogger, origLevel := slog.Default(), LogLevel()
+	t.Cleanup(func() {
+		slog.SetDefault(origLogger)
+		SetLogLevel(origLevel)
+	})
+	return filepath.Join(t.TempDir(), "app.log")
+}
+
+func serveThrough(t *testing.T, cfg LogConfig, path string) {
+	t.Helper()
+	mw, err := RequestLoggerWithOptions(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRequestLoggerVersion(t *testing.T) {
+	logFile := setupLogTest(t)
+	t.Setenv("SERVICE_VERSION", "v1.2.3")
+
+	serveThrough(t, LogConfig{Output: "file", File: logFile}, "/")
+	if out := readFile(t, logFile); !strings.Contains(out, `"version":"v1.2.3"`) {
+		t.Fatalf("want version from BuildInfo, got %s", out)
+	}
+}
+
+// Records logged with a traced context carry the trace in the schema's
+// correlation fields.
+func TestRequestLoggerTraceCorrelation(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+	}))
+
+	for _, tc := range []struct {
+		schema, project string
+		want            []string
+	}{
+		{"", "", []string{`"logging.googleapis.com/trace":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+			`"logging.googleapis.com/spanId":"00f067aa0ba902b7"`, `"logging.googleapis.com/trace_sampled":true`}},
+		{"gcp", "acme", []string{`"logging.googleapis.com/trace":"projects/acme/traces/4bf92f3577b34da6a3ce929d0e0e4736"`}},
+		{"ecs", "", []string{`"trace.id":"4bf92f3577b34da6a3ce929d0e0e4736"`, `"span.id":"00f067aa0ba902b7"`}},
+		{"standard", "", []string{`"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`, `"span_id":"00f067aa0ba902b7"`}},
+	} {
+		t.Run(tc.schema, func(t *testing.T) {
+			logFile := setupLogTest(t)
+			t.Setenv("GOOGLE_CLOUD_PROJECT", tc.project)
+			if _, err := RequestLoggerWithOptions(LogConfig{Schema: tc.schema, Output: "file", File: logFile}); err != nil {
+				t.Fatal(err)
+			}
+			LogInfo(ctx, "traced")
+
+			out := readFile(t, logFile)
+			for _, w := range tc.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("want %s in %s", w, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// defaultSkipExtensions are the static asset formats not logged unless
+// LogSkipConfig.Extensions says otherwise.
+var defaultSkipExtensions = []string{"css", "js", "woff2", "ico", "wasm", "svg"}
+
+// LogSkipConfig selects requests that [RequestLoggerWithOptions] does not
+// log. Responses with a 5xx status are always logged.
+type LogSkipConfig struct {
+	// Extensions are URL format suffixes (see chi's middleware.URLFormat)
+	// of static assets. Nil means css, js, woff2, ico, wasm and svg; an
+	// empty list logs every format.
+	Extensions []string `mapstructure:"extensions"`
+
+	// SampleRate logs this fraction (0 to 1) of the successful requests
+	// skipped by Extensions. Zero logs none.
+	SampleRate float64 `mapstructure:"sample_rate"`
+
+	// PathPrefixes skips requests whose URL path starts with one of them,
+	// e.g. /static/.
+	PathPrefixes []string `mapstructure:"path_prefixes"`
+
+	// Routes skips requests matched by one of these chi route patterns,
+	// e.g. /healthz.
+	Routes []string `mapstructure:"routes"`
+
+	// Statuses skips responses with one of these status codes, e.g. 304.
+	Statuses []int `mapstructure:"statuses"`
+}
+
+// sampleFloat is rand.Float64, replaced in tests.
+var sampleFloat = rand.Float64
+
+func (c LogSkipConfig) validate() error {
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("log sample rate %v out of range [0, 1]", c.SampleRate)
+	}
+	return nil
+}
+
+// skip reports whether r, answered with status, is not logged.
+func (c LogSkipConfig) skip(r *http.Request, status int) bool {
+	if status >= http.StatusInternalServerError {
+		return false
+	}
+	if slices.Contains(c.Statuses, status) {
+		return true
+	}
+	for _, p := range c.PathPrefixes {
+		if strings.HasPrefix(r.URL.Path, p) {
+			return true
+		}
+	}
+	if len(c.Routes) > 0 {
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && slices.Contains(c.Routes, rctx.RoutePattern()) {
+			return true
+		}
+	}
+
+	exts := c.Extensions
+	if exts == nil {
+		exts = defaultSkipExtensions
+	}
+	urlFormat, _ := r.Context().Value(middleware.URLFormatCtxKey).(string)
+	if urlFormat == "" || !slices.Contains(exts, urlFormat) {
+		return false
+	}
+	if status < http.StatusBadRequest && c.SampleRate > 0 {
+		return sampleFloat() >= c.SampleRate
+	}
+	return true
+}
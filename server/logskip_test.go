@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestLogSkip(t *testing.T) {
+	sampleFloat = func() float64 { return 0.3 }
+	t.Cleanup(func() { sampleFloat = rand.Float64 })
+
+	custom := LogSkipConfig{
+		Extensions:   []string{"png"},
+		PathPrefixes: []string{"/static/"},
+		Routes:       []string{"/healthz"},
+		Statuses:     []int{304},
+	}
+	for _, tc := range []struct {
+		name    string
+		cfg     LogSkipConfig
+		path    string
+		format  string
+		route   string
+		status  int
+		skipped bool
+	}{
+		{"default skips css", LogSkipConfig{}, "/app.css", "css", "", 200, true},
+		{"default logs json", LogSkipConfig{}, "/api/items.json", "json", "", 200, false},
+		{"5xx always logged", LogSkipConfig{}, "/app.css", "css", "", 500, false},
+		{"empty extensions log all", LogSkipConfig{Extensions: []string{}}, "/app.css", "css", "", 200, false},
+		{"custom extension", custom, "/logo.png", "png", "", 200, true},
+		{"custom replaces defaults", custom, "/app.css", "css", "", 200, false},
+		{"path prefix", custom, "/static/app", "", "", 200, true},
+		{"route", custom, "/healthz", "", "/healthz", 200, true},
+		{"status", custom, "/page", "", "", 304, true},
+		{"5xx beats status", LogSkipConfig{Statuses: []int{503}}, "/page", "", "", 503, false},
+		{"sampled in", LogSkipConfig{SampleRate: 0.5}, "/app.css", "css", "", 200, false},
+		{"sampled out", LogSkipConfig{SampleRate: 0.2}, "/app.css", "css", "", 200, true},
+		{"sampling only for successes", LogSkipConfig{SampleRate: 1}, "/app.css", "css", "", 404, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tc.path, nil)
+			ctx := context.WithValue(r.Context(), middleware.URLFormatCtxKey, tc.format)
+			rctx := chi.NewRouteContext()
+			if tc.route != "" {
+				rctx.RoutePatterns = []string{tc.route}
+			}
+			r = r.WithContext(context.WithValue(ctx, chi.RouteCtxKey, rctx))
+
+			if got := tc.cfg.skip(r, tc.status); got != tc.skipped {
+				t.Fatalf("want skipped=%v, got %v", tc.skipped, got)
+			}
+		})
+	}
+}
+
+func TestLogSkipSampleRateRange(t *testing.T) {
+	setupLogTest(t)
+	if _, err := RequestLoggerWithOptions(LogConfig{Skip: LogSkipConfig{SampleRate: 1.5}}); err == nil {
+		t.Fatal("want error for sample rate above 1")
+	}
+}
+
+// JSON API responses are logged through the middleware, too.
+func TestRequestLoggerLogsJSONFormat(t *testing.T) {
+	logFile := setupLogTest(t)
+	mw, err := RequestLoggerWithOptions(LogConfig{Output: "file", File: logFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := chi.NewRouter()
+	r.Use(middleware.URLFormat, mw)
+	r.Get("/items", func(w http.ResponseWriter, r *http.Request) {})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items.json", nil))
+
+	if out := readFile(t, logFile); !strings.Contains(out, `"status":200`) {
+		t.Fatalf("want /items.json logged, got %q", out)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceKeys names the trace correlation fields of a log schema.
+type traceKeys struct {
+	trace, span, sampled string
+	// gcp formats the trace ID as projects/<project>/traces/<id> when
+	// GOOGLE_CLOUD_PROJECT is set, as Cloud Logging expects.
+	gcp bool
+}
+
+func logTraceKeys(schema string) traceKeys {
+	switch strings.ToLower(schema) {
+	case "", "gcp":
+		return traceKeys{
+			trace:   "logging.googleapis.com/trace",
+			span:    "logging.googleapis.com/spanId",
+			sampled: "logging.googleapis.com/trace_sampled",
+			gcp:     true,
+		}
+	case "ecs":
+		return traceKeys{trace: "trace.id", span: "span.id"}
+	default:
+		return traceKeys{trace: "trace_id", span: "span_id"}
+	}
+}
+
+// traceHandler adds the trace and span ID of the record's context, as set
+// by the tracing package, to every record.
+type traceHandler struct {
+	slog.Handler
+	keys traceKeys
+}
+
+func (h *traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		traceID := sc.TraceID().String()
+		if project := os.Getenv("GOOGLE_CLOUD_PROJECT"); h.keys.gcp && project != "" {
+			traceID = fmt.Sprintf("projects/%s/traces/%s", project, traceID)
+		}
+		r.AddAttrs(slog.String(h.keys.trace, traceID), slog.String(h.keys.span, sc.SpanID().String()))
+		if h.keys.sampled != "" {
+			r.AddAttrs(slog.Bool(h.keys.sampled, sc.IsSampled()))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &traceHandler{h.Handler.WithAttrs(attrs), h.keys}
+}
+
+func (h *traceHandler) WithGroup(name string) slog.Handler {
+	return &traceHandler{h.Handler.WithGroup(name), h.keys}
+}
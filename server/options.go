@@ -0,0 +1,133 @@
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+// Defaults applied by [ServerConfig] to zero-valued fields. They are chosen
+// to close slowloris-style exposure without cutting off normal requests.
+const (
+	DefaultReadHeaderTimeout = 5 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 60 * time.Second
+	DefaultIdleTimeout       = 120 * time.Second
+	DefaultMaxHeaderBytes    = 1 << 20
+	DefaultShutdownTimeout   = 15 * time.Second
+)
+
+// ServerConfig holds the timeouts and limits of the listeners started by
+// [ListenAndServeContext]. It can be embedded in the application config and
+// decoded through [ReadInConfig], e.g. under a "server" key:
+//
+//	server:
+//	  read_header_timeout: 5s
+//	  write_timeout: 2m
+//
+// Zero fields fall back to the Default* constants; a negative duration
+// disables that timeout. ShutdownTimeout cannot be disabled: shutdown always
+// has a deadline, and a negative value also means the default.
+// ShutdownDelay (default 0) keeps the listeners open for that long after the
+// [WithOnShutdown] hooks ran, giving load balancers time to notice a failing
+// readiness probe before connections are refused.
+//
+// SocketMode is the file mode of "unix:" socket files; zero leaves them at
+// the process umask. Write it as a quoted octal string ("0660") so YAML
+// does not read it as decimal.
+//
+// The plain-HTTP branch applies every field to its *http.Server. In FastCGI
+// mode the web server owns the connection, so only WriteTimeout (as a
+// per-request context deadline) and ShutdownTimeout apply.
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	ReadTimeout       time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout      time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout       time.Duration `mapstructure:"idle_timeout"`
+	MaxHeaderBytes    int           `mapstructure:"max_header_bytes"`
+	ShutdownTimeout   time.Duration `mapstructure:"shutdown_timeout"`
+	ShutdownDelay     time.Duration `mapstructure:"shutdown_delay"`
+	SocketMode        fs.FileMode   `mapstructure:"socket_mode"`
+}
+
+// withDefaults returns a copy of c with zero fields set to the defaults.
+func (c ServerConfig) withDefaults() ServerConfig {
+	if c.ReadHeaderTimeout == 0 {
+		c.ReadHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = DefaultReadTimeout
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = DefaultWriteTimeout
+	}
+	if c.IdleTimeout == 0 {
+		c.IdleTimeout = DefaultIdleTimeout
+	}
+	if c.MaxHeaderBytes == 0 {
+		c.MaxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	if c.ShutdownTimeout <= 0 {
+		c.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	return c
+}
+
+// newHTTPServer builds the *http.Server for the plain-HTTP branch.
+func newHTTPServer(addr string, handler http.Handler, c ServerConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		ReadTimeout:       c.ReadTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+	}
+}
+
+// Option configures [ListenAndServeContext].
+type Option func(*options)
+
+type options struct {
+	cfg        ServerConfig
+	onShutdown []func()
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.cfg = o.cfg.withDefaults()
+	return o
+}
+
+// WithServerConfig sets the timeouts and limits of the listeners. Options
+// are applied in order, so a later [WithShutdownTimeout] overrides
+// c.ShutdownTimeout.
+func WithServerConfig(c ServerConfig) Option {
+	return func(o *options) {
+		o.cfg = c
+	}
+}
+
+// WithShutdownTimeout bounds how long a graceful shutdown waits for in-flight
+// requests to finish before giving up. Defaults to [DefaultShutdownTimeout];
+// values <= 0 keep the default.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.cfg.ShutdownTimeout = d
+		}
+	}
+}
+
+// WithOnShutdown registers fn to run when a graceful shutdown begins,
+// before any listener stops accepting connections. Use it to flip
+// readiness, e.g. server.WithOnShutdown(healthRegistry.Drain).
+func WithOnShutdown(fn func()) Option {
+	return func(o *options) {
+		o.onShutdown = append(o.onShutdown, fn)
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServerConfigDefaults(t *testing.T) {
+	o := newOptions(nil)
+	srv := newHTTPServer(":0", nil, o.cfg)
+
+	if srv.ReadHeaderTimeout != DefaultReadHeaderTimeout ||
+		srv.ReadTimeout != DefaultReadTimeout ||
+		srv.WriteTimeout != DefaultWriteTimeout ||
+		srv.IdleTimeout != DefaultIdleTimeout ||
+		srv.MaxHeaderBytes != DefaultMaxHeaderBytes {
+		t.Fatalf("unexpected defaults: %+v", srv)
+	}
+	if o.cfg.ShutdownTimeout != DefaultShutdownTimeout {
+		t.Fatalf("ShutdownTimeout: want %v, got %v", DefaultShutdownTimeout, o.cfg.ShutdownTimeout)
+	}
+
+	o = newOptions([]Option{WithServerConfig(ServerConfig{ShutdownTimeout: -1})})
+	if o.cfg.ShutdownTimeout != DefaultShutdownTimeout {
+		t.Errorf("ShutdownTimeout: negative must fall back to %v, got %v", DefaultShutdownTimeout, o.cfg.ShutdownTimeout)
+	}
+}
+
+func TestServerConfigOverrides(t *testing.T) {
+	o := newOptions([]Option{
+		WithServerConfig(ServerConfig{
+			ReadHeaderTimeout: time.Second,
+			WriteTimeout:      -1,
+			MaxHeaderBytes:    4096,
+			ShutdownTimeout:   time.Minute,
+		}),
+		WithShutdownTimeout(2 * time.Minute),
+	})
+	srv := newHTTPServer(":0", nil, o.cfg)
+
+	if srv.ReadHeaderTimeout != time.Second {
+		t.Errorf("ReadHeaderTimeout: want 1s, got %v", srv.ReadHeaderTimeout)
+	}
+	if srv.WriteTimeout != -1 {
+		t.Errorf("WriteTimeout: negative must disable, got %v", srv.WriteTimeout)
+	}
+	if srv.ReadTimeout != DefaultReadTimeout {
+		t.Errorf("ReadTimeout: want default, got %v", srv.ReadTimeout)
+	}
+	if srv.MaxHeaderBytes != 4096 {
+		t.Errorf("MaxHeaderBytes: want 4096, got %d", srv.MaxHeaderBytes)
+	}
+	if o.cfg.ShutdownTimeout != 2*time.Minute {
+		t.Errorf("ShutdownTimeout: later option must win, got %v", o.cfg.ShutdownTimeout)
+	}
+}
+
+// ServerConfig is meant to be decoded through ReadInConfig.
+func TestServerConfigReadInConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("CONFIG_BASE_PATH", "")
+	t.Setenv("HOME", home)
+	mustWrite(t, filepath.Join(home, ".config", "myapp.yaml"), "server:\n  read_header_timeout: 3s\n  max_header_bytes: 8192\n")
+
+	var cfg struct {
+		Server ServerConfig `mapstructure:"server"`
+	}
+	if err := ReadInConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.ReadHeaderTimeout != 3*time.Second || cfg.Server.MaxHeaderBytes != 8192 {
+		t.Fatalf("unexpected decode: %+v", cfg.Server)
+	}
+}
@@ -0,0 +1,394 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// LogRotateConfig rotates the log file of the file and both outputs (and
+// the Hostsharing per-domain log file), where no external logrotate is
+// available. Rotated files are renamed to <file>.<timestamp> next to it.
+// The zero value never rotates.
+type LogRotateConfig struct {
+	// MaxSizeMB rotates the file before it grows beyond this many
+	// megabytes. Zero disables size-based rotation.
+	MaxSizeMB int `mapstructure:"max_size_mb"`
+
+	// MaxAge rotates the file once it has been written to for this long,
+	// e.g. 24h. Zero disables age-based rotation.
+	MaxAge time.Duration `mapstructure:"max_age"`
+
+	// MaxBackups is the number of rotated files kept; older ones are
+	// removed. Zero keeps all of them.
+	MaxBackups int `mapstructure:"max_backups"`
+
+	// Compress gzips rotated files.
+	Compress bool `mapstructure:"compress"`
+}
+
+// backupTimeFormat is the suffix of rotated files; it sorts by time. A
+// second rotation within the same millisecond adds "-1", "-2" and so on.
+const backupTimeFormat = "20060102T150405.000"
+
+// logNow is time.Now, replaced in tests.
+var logNow = time.Now
+
+// rotatingFile is an append-only log file that rotates itself according to
+// its LogRotateConfig and can be reopened after an external rename.
+type rotatingFile struct {
+	path    string
+	cfg     LogRotateConfig
+	maxSize int64
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	closed bool
+
+	// The mill worker compresses and prunes rotated files in the
+	// background, one after the other in the order they were rotated, so a
+	// rotation never waits for it. rotate queues them in pending and wakes
+	// the worker; the first rotation starts it and Close stops it.
+	millMu  sync.Mutex
+	pending []string
+	wake    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func openRotatingFile(path string, cfg LogRotateConfig) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, cfg: cfg, maxSize: int64(cfg.MaxSizeMB) << 20}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	// A FastCGI process is restarted often; count the age from the last
+	// rotation rather than from this start.
+	if backups := r.backups(); len(backups) > 0 {
+		r.opened = backups[0].t
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := openLogFile(r.path)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.opened = f, fi.Size(), logNow()
+	return nil
+}
+
+// Write appends p, rotating first when p would exceed the size limit or
+// the file is too old.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, os.ErrClosed
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.due(len(p)) {
+		// Not through log or slog: both end up in this writer.
+		if err := r.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "config-mate: cannot rotate log file: %v\n", err)
+			if r.f == nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) due(n int) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+	return r.cfg.MaxAge > 0 && logNow().Sub(r.opened) >= r.cfg.MaxAge
+}
+
+// rotate renames the current file to a timestamped backup and starts a new
+// one. Compression and cleanup of backups happen in the background.
+func (r *rotatingFile) rotate() error {
+	r.f.Close()
+	r.f = nil
+
+	backup := r.backupName()
+	if err := os.Rename(r.path, backup); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		if oerr := r.open(); oerr != nil {
+			return errors.Join(err, oerr)
+		}
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.millMu.Lock()
+	r.pending = append(r.pending, backup)
+	r.millMu.Unlock()
+	if r.wake == nil {
+		r.wake = make(chan struct{}, 1)
+		r.wg.Add(1)
+		go r.millWorker(r.wake)
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default: // already woken; the worker takes everything pending
+	}
+	return nil
+}
+
+// backupName returns a name for the next rotated file that is not taken,
+// compressed or not.
+func (r *rotatingFile) backupName() string {
+	stamp := r.path + "." + logNow().Format(backupTimeFormat)
+	name := stamp
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s-%d", stamp, i)
+	}
+	return name
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func (r *rotatingFile) millWorker(wake <-chan struct{}) {
+	defer r.wg.Done()
+	for range wake {
+		for {
+			r.millMu.Lock()
+			if len(r.pending) == 0 {
+				r.millMu.Unlock()
+				break
+			}
+			backup := r.pending[0]
+			r.pending = r.pending[1:]
+			r.millMu.Unlock()
+			r.mill(backup)
+		}
+	}
+}
+
+func (r *rotatingFile) mill(backup string) {
+	if r.cfg.Compress {
+		// A backup that is gone was removed by hand or never created,
+		// when the file was moved away before the rotation.
+		if err := gzipFile(backup); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "config-mate: cannot compress %s: %v\n", backup, err)
+		}
+	}
+	if r.cfg.MaxBackups <= 0 {
+		return
+	}
+	backups := r.backups()
+	if len(backups) <= r.cfg.MaxBackups {
+		return
+	}
+	for _, b := range backups[r.cfg.MaxBackups:] {
+		if err := os.Remove(b.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "config-mate: cannot remove old log file: %v\n", err)
+		}
+	}
+}
+
+type logBackup struct {
+	path string
+	t    time.Time
+	seq  int // of rotations within the same millisecond
+}
+
+// backups lists the rotated files of r, newest first.
+func (r *rotatingFile) backups() []logBackup {
+	dir, base := filepath.Split(r.path)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil
+	}
+	var backups []logBackup
+	for _, e := range entries {
+		suffix, ok := strings.CutPrefix(e.Name(), base+".")
+		if !ok || e.IsDir() {
+			continue
+		}
+		stamp, seq, _ := strings.Cut(strings.TrimSuffix(suffix, ".gz"), "-")
+		t, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		b := logBackup{path: filepath.Join(dir, e.Name()), t: t}
+		if seq != "" {
+			if b.seq, err = strconv.Atoi(seq); err != nil {
+				continue
+			}
+		}
+		backups = append(backups, b)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		if !backups[i].t.Equal(backups[j].t) {
+			return backups[i].t.After(backups[j].t)
+		}
+		return backups[i].seq > backups[j].seq
+	})
+	return backups
+}
+
+func gzipFile(src string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dst := src + ".gz"
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Reopen closes the file and opens its path again, e.g. after an external
+// logrotate moved it away.
+func (r *rotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != nil {
+		r.f.Close()
+		r.f = nil
+	}
+	return r.open()
+}
+
+// configure applies cfg from now on.
+func (r *rotatingFile) configure(cfg LogRotateConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cfg, r.maxSize = cfg, int64(cfg.MaxSizeMB)<<20
+}
+
+// Close closes the file and waits for background compression and cleanup.
+// Later writes fail.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	r.closed = true
+	var err error
+	if r.f != nil {
+		err = r.f.Close()
+		r.f = nil
+	}
+	if r.wake != nil {
+		close(r.wake)
+		r.wake = nil
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return err
+}
+
+// reopener holds the log file of the most recently built request logger,
+// which is the one SIGHUP and [ReopenLogFile] act on.
+var reopener struct {
+	once sync.Once
+	mu   sync.Mutex
+	file *rotatingFile
+}
+
+// sharedLogFile opens the log file at path and makes it the one reopened
+// on SIGHUP. A logger built again for the same path shares the open file,
+// with cfg applied; the file of another path is closed, so rebuilding the
+// logger leaks neither descriptors nor mill goroutines. The signal handler
+// is installed on first use only, so processes that never log to a file
+// keep the default SIGHUP behaviour.
+func sharedLogFile(path string, cfg LogRotateConfig) (*rotatingFile, error) {
+	reopener.mu.Lock()
+	defer reopener.mu.Unlock()
+
+	if old := reopener.file; old != nil && old.path == path {
+		old.configure(cfg)
+		return old, nil
+	}
+	r, err := openRotatingFile(path, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if old := reopener.file; old != nil {
+		old.Close()
+	}
+	reopener.file = r
+
+	reopener.once.Do(func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGHUP)
+		go func() {
+			for range ch {
+				if err := ReopenLogFile(); err != nil {
+					fmt.Fprintf(os.Stderr, "config-mate: cannot reopen log file: %v\n", err)
+				}
+			}
+		}()
+	})
+	return r, nil
+}
+
+// ReopenLogFile reopens the log file of the request logger, as SIGHUP
+// does. Use it after an external logrotate moved the file away. Without a
+// log file it is a no-op.
+func ReopenLogFile() error {
+	reopener.mu.Lock()
+	r := reopener.file
+	reopener.mu.Unlock()
+
+	if r == nil {
+		return nil
+	}
+	return r.Reopen()
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateBySizeKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	clock := stubLogNow(t)
+	stderr := captureStderr(t)
+
+	r, err := openRotatingFile(path, LogRotateConfig{MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.maxSize = 9
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		*clock = clock.Add(time.Second)
+		if _, err := io.WriteString(r, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, path); got != "five\n" {
+		t.Fatalf("current file: want five, got %q", got)
+	}
+	backups := r.backups()
+	if len(backups) != 2 {
+		t.Fatalf("want 2 backups, got %v", backups)
+	}
+	for i, want := range []string{"four\n", "three\n"} {
+		if !strings.HasSuffix(backups[i].path, ".gz") {
+			t.Fatalf("backup %s not compressed", backups[i].path)
+		}
+		if got := readGzip(t, backups[i].path); got != want {
+			t.Errorf("backup %d: want %q, got %q", i, want, got)
+		}
+	}
+	if out := stderr(); out != "" {
+		t.Errorf("want nothing on stderr, got %q", out)
+	}
+}
+
+// Rotations within the same millisecond keep every backup, in order.
+func TestRotateSameMillisecond(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	stubLogNow(t)
+	stderr := captureStderr(t)
+
+	r, err := openRotatingFile(path, LogRotateConfig{MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.maxSize = 4
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		if _, err := io.WriteString(r, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups := r.backups()
+	if len(backups) != 2 {
+		t.Fatalf("want 2 backups, got %v", backups)
+	}
+	for i, want := range []string{"three\n", "two\n"} {
+		if got := readFile(t, backups[i].path); got != want {
+			t.Errorf("backup %d: want %q, got %q", i, want, got)
+		}
+	}
+	if out := stderr(); out != "" {
+		t.Errorf("want nothing on stderr, got %q", out)
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	clock := stubLogNow(t)
+
+	r, err := openRotatingFile(path, LogRotateConfig{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	io.WriteString(r, "old\n")
+	*clock = clock.Add(30 * time.Minute)
+	io.WriteString(r, "still old\n")
+	*clock = clock.Add(time.Hour)
+	io.WriteString(r, "new\n")
+	r.Close()
+
+	if got := readFile(t, path); got != "new\n" {
+		t.Fatalf("want only the new line, got %q", got)
+	}
+	if backups := r.backups(); len(backups) != 1 || readFile(t, backups[0].path) != "old\nstill old\n" {
+		t.Fatalf("want one backup with the old lines, got %v", backups)
+	}
+
+	// The age survives a restart through the newest backup.
+	*clock = clock.Add(2 * time.Hour)
+	r2, err := openRotatingFile(path, LogRotateConfig{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(r2, "after restart\n")
+	r2.Close()
+	if got := readFile(t, path); got != "after restart\n" {
+		t.Fatalf("want rotation after restart, got %q", got)
+	}
+}
+
+func stubLogNow(t *testing.T) *time.Time {
+	t.Helper()
+	clock := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+	logNow = func() time.Time { return clock }
+	t.Cleanup(func() { logNow = time.Now })
+	return &clock
+}
+
+// captureStderr redirects os.Stderr for the test; the returned func
+// returns what was written so far.
+func captureStderr(t *testing.T) func() string {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := os.Stderr
+	os.Stderr = f
+	t.Cleanup(func() {
+		os.Stderr = orig
+		f.Close()
+	})
+	return func() string { return readFile(t, f.Name()) }
+}
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// Rebuilding the request logger shares the open file of the same path and
+// closes the one of a previous path.
+func TestSharedLogFile(t *testing.T) {
+	logFile := setupLogTest(t)
+	for range 2 {
+		if _, err := RequestLoggerWithOptions(LogConfig{Output: "file", File: logFile}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := reopener.file
+	if _, err := RequestLoggerWithOptions(LogConfig{Output: "file", File: logFile, Rotate: LogRotateConfig{MaxBackups: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if reopener.file != first || first.cfg.MaxBackups != 3 {
+		t.Fatal("want the open file shared, with the new rotate config")
+	}
+
+	other := filepath.Join(t.TempDir(), "other.log")
+	if _, err := RequestLoggerWithOptions(LogConfig{Output: "file", File: other}); err != nil {
+		t.Fatal(err)
+	}
+	if reopener.file == first {
+		t.Fatal("want a new file for another path")
+	}
+	if _, err := first.Write([]byte("x\n")); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("want the previous file closed, got %v", err)
+	}
+}
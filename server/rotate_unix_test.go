@@ -0,0 +1,31 @@
+//go:build unix
+
+package server
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// SIGHUP reopens the file after an external logrotate moved it away.
+func TestReopenLogFileOnSIGHUP(t *testing.T) {
+	logFile := setupLogTest(t)
+	if _, err := RequestLoggerWithOptions(LogConfig{Output: "file", File: logFile}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(logFile, logFile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(logFile); err == nil {
+			return
+		}
+	}
+	t.Fatal("log file not reopened after SIGHUP")
+}
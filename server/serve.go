@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/fcgi"
+	"sync/atomic"
+	"time"
+)
+
+// endpoint is one listener managed by [run]. serve blocks until the
+// listener fails or shutdown is called; shutdown stops accepting new
+// connections and waits for in-flight requests until ctx expires.
+type endpoint interface {
+	serve() error
+	shutdown(ctx context.Context) error
+	String() string
+}
+
+// run serves all endpoints until ctx is done or one of them fails, then
+// runs the shutdown hooks, waits o.cfg.ShutdownDelay, and shuts every
+// endpoint down within o.cfg.ShutdownTimeout. The first serve failure wins
+// over shutdown errors.
+func run(ctx context.Context, o *options, eps ...endpoint) error {
+	errc := make(chan error, len(eps))
+	for _, ep := range eps {
+		go func() {
+			if err := ep.serve(); err != nil {
+				errc <- fmt.Errorf("%s: %w", ep, err)
+				return
+			}
+			errc <- nil
+		}()
+	}
+
+	var first error
+	select {
+	case first = <-errc:
+	case <-ctx.Done():
+	}
+
+	for _, fn := range o.onShutdown {
+		fn()
+	}
+	if first == nil && o.cfg.ShutdownDelay > 0 {
+		select {
+		case first = <-errc:
+		case <-time.After(o.cfg.ShutdownDelay):
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), o.cfg.ShutdownTimeout)
+	defer cancel()
+	for _, ep := range eps {
+		if err := ep.shutdown(shutdownCtx); err != nil && first == nil {
+			first = fmt.Errorf("%s: shutdown: %w", ep, err)
+		}
+	}
+	return first
+}
+
+// httpEndpoint serves srv on ln, with TLS when srv.TLSConfig is set.
+type httpEndpoint struct {
+	srv *http.Server
+	ln  net.Listener
+}
+
+func newHTTPEndpoint(ln net.Listener, srv *http.Server) *httpEndpoint {
+	return &httpEndpoint{srv: srv, ln: ln}
+}
+
+func (e *httpEndpoint) serve() error {
+	var err error
+	if e.srv.TLSConfig != nil {
+		err = e.srv.ServeTLS(e.ln, "", "")
+	} else {
+		err = e.srv.Serve(e.ln)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (e *httpEndpoint) shutdown(ctx context.Context) error {
+	return e.srv.Shutdown(ctx)
+}
+
+func (e *httpEndpoint) String() string {
+	if e.srv.TLSConfig != nil {
+		return "https on " + e.ln.Addr().String()
+	}
+	return "http on " + e.ln.Addr().String()
+}
+
+// fcgiEndpoint serves FastCGI on ln. net/http/fcgi has no Shutdown, so the
+// endpoint counts in-flight requests itself and drains them after closing
+// the listener. It has no connection-level timeouts either; WriteTimeout is
+// applied as a deadline on each request's context instead.
+type fcgiEndpoint struct {
+	ln       net.Listener
+	handler  http.Handler
+	active   atomic.Int64
+	draining atomic.Bool
+}
+
+func newFCGIEndpoint(ln net.Listener, handler http.Handler, c ServerConfig) *fcgiEndpoint {
+	e := &fcgiEndpoint{ln: ln}
+	e.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.active.Add(1)
+		defer e.active.Add(-1)
+		if c.WriteTimeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), c.WriteTimeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		handler.ServeHTTP(w, r)
+	})
+	return e
+}
+
+func (e *fcgiEndpoint) serve() error {
+	err := fcgi.Serve(e.ln, e.handler)
+	if e.draining.Load() {
+		// Accept fails once shutdown closed the listener; that is the
+		// expected way out, not a failure.
+		return nil
+	}
+	return err
+}
+
+// drainPollInterval mirrors the polling approach of http.Server.Shutdown.
+const drainPollInterval = 50 * time.Millisecond
+
+func (e *fcgiEndpoint) shutdown(ctx context.Context) error {
+	e.draining.Store(true)
+	if err := e.ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		if n := e.active.Load(); n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d request(s) still in flight: %w", e.active.Load(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *fcgiEndpoint) String() string {
+	return "fcgi on " + e.ln.Addr().String()
+}
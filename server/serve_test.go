@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// HTTP shutdown must let a request that is already running finish and
+// answer before run returns nil.
+func TestRunHTTPDrainsInFlightRequests(t *testing.T) {
+	ln := mustListen(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		io.WriteString(w, "done")
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, newOptions(nil), newHTTPEndpoint(ln, srv)) }()
+
+	resp := make(chan string, 1)
+	go func() {
+		r, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			resp <- "error: " + err.Error()
+			return
+		}
+		defer r.Body.Close()
+		b, _ := io.ReadAll(r.Body)
+		resp <- string(b)
+	}()
+
+	<-started
+	cancel()
+	time.Sleep(2 * drainPollInterval)
+	close(release)
+
+	if got := <-resp; got != "done" {
+		t.Fatalf("in-flight request: want %q, got %q", "done", got)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("run: want nil, got %v", err)
+	}
+}
+
+// FCGI shutdown closes the listener and returns nil when idle.
+func TestRunFCGIClosesListener(t *testing.T) {
+	ln := mustListen(t)
+	addr := ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, newOptions(nil), newFCGIEndpoint(ln, http.NotFoundHandler(), ServerConfig{})) }()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("run: want nil, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after cancel")
+	}
+	if c, err := net.Dial("tcp", addr); err == nil {
+		c.Close()
+		t.Fatalf("listener on %s still accepts connections", addr)
+	}
+}
+
+// FCGI shutdown reports requests still running when the timeout expires.
+func TestFCGIShutdownTimesOutWithRequestsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	ep := newFCGIEndpoint(mustListen(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}), ServerConfig{})
+	go ep.handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	for ep.active.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*drainPollInterval)
+	defer cancel()
+	err := ep.shutdown(ctx)
+	if err == nil || !strings.Contains(err.Error(), "1 request(s) still in flight") {
+		t.Fatalf("want in-flight timeout error, got %v", err)
+	}
+}
+
+func TestListenAndServeContextReturnsNilOnCancel(t *testing.T) {
+	t.Setenv("FCGI_LISTEN", "")
+	t.Setenv("ADDR", "127.0.0.1:0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ListenAndServeContext(ctx, http.NotFoundHandler(), WithShutdownTimeout(time.Second)); err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+}
+
+func mustListen(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ln
+}
+
+// FastCGI requests get WriteTimeout as a context deadline.
+func TestFCGIRequestDeadline(t *testing.T) {
+	var deadline time.Time
+	var ok bool
+	ep := newFCGIEndpoint(mustListen(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}), ServerConfig{WriteTimeout: time.Minute})
+
+	before := time.Now()
+	ep.handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if !ok {
+		t.Fatal("want a request deadline, got none")
+	}
+	if d := deadline.Sub(before); d < 59*time.Second || d > 61*time.Second {
+		t.Fatalf("deadline: want ~1m from now, got %v", d)
+	}
+}
+
+// Shutdown hooks run first, and the listener keeps serving during
+// ShutdownDelay so readiness probes can report draining.
+func TestRunShutdownHooksAndDelay(t *testing.T) {
+	ln := mustListen(t)
+	var draining atomic.Bool
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if draining.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})}
+	o := newOptions([]Option{
+		WithServerConfig(ServerConfig{ShutdownDelay: 500 * time.Millisecond}),
+		WithOnShutdown(func() { draining.Store(true) }),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, o, newHTTPEndpoint(ln, srv)) }()
+	cancel()
+	for !draining.Load() {
+		time.Sleep(time.Millisecond)
+	}
+
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("listener must stay open during ShutdownDelay: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("want 503 while draining, got %d", resp.StatusCode)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("run: %v", err)
+	}
+}
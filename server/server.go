@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Server runs several listeners under one lifecycle: FastCGI and plain
+// HTTP(S) for the public Handler, plus an optional admin listener for
+// internal endpoints. It is the multi-listener form of
+// [ListenAndServeContext], e.g. for migrating from Hostsharing FastCGI to
+// HTTP on a VM while both front ends still send traffic.
+//
+// Every address accepts the forms described at [ListenAndServe]. An empty
+// address disables that listener; at least one must be set.
+type Server struct {
+	// Handler serves the public FastCGI and HTTP listeners.
+	Handler http.Handler
+
+	// FCGIAddr is the FastCGI listener; "fd:0" serves on stdin like a
+	// FastCGI process spawned by Apache.
+	FCGIAddr string
+
+	// HTTPAddr is the plain-HTTP listener. With TLSCertFile and TLSKeyFile
+	// set it serves HTTPS, and RedirectAddr (optional) redirects plain HTTP
+	// to it.
+	HTTPAddr     string
+	TLSCertFile  string
+	TLSKeyFile   string
+	RedirectAddr string
+
+	// AdminAddr is the listener for internal endpoints (health, metrics,
+	// profiling). Bind it to localhost or a private network; it must never
+	// be exposed publicly. AdminHandler defaults to [NewAdminMux]. It uses
+	// the [ServerConfig] of the public listeners but no WriteTimeout, so
+	// long CPU profiles can finish.
+	AdminAddr    string
+	AdminHandler http.Handler
+}
+
+// NewServerFromEnv returns a Server with FCGIAddr from FCGI_LISTEN, HTTPAddr
+// from ADDR (or PORT), the TLS_* variables, and AdminAddr from ADMIN_ADDR.
+// Unlike [ListenAndServe], FastCGI and HTTP run side by side when both
+// FCGI_LISTEN and ADDR/PORT are set.
+func NewServerFromEnv(handler http.Handler) (*Server, error) {
+	certFile, keyFile, err := tlsFiles()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Handler:      handler,
+		FCGIAddr:     os.Getenv("FCGI_LISTEN"),
+		TLSCertFile:  certFile,
+		TLSKeyFile:   keyFile,
+		RedirectAddr: os.Getenv("TLS_REDIRECT_ADDR"),
+		AdminAddr:    os.Getenv("ADMIN_ADDR"),
+	}
+	if os.Getenv("ADDR") != "" || os.Getenv("PORT") != "" {
+		s.HTTPAddr = listenAddr()
+	}
+	return s, nil
+}
+
+// ListenAndServe opens all configured listeners and serves until ctx is
+// cancelled, the process receives SIGINT/SIGTERM, or one listener fails.
+// Then every listener is shut down gracefully (public ones first, admin
+// last so probes keep answering while requests drain) and the first fatal
+// error is returned; a clean shutdown returns nil.
+func (s *Server) ListenAndServe(ctx context.Context, opts ...Option) error {
+	o := newOptions(opts)
+
+	eps, err := s.endpoints(o)
+	if err != nil {
+		return err
+	}
+	for _, ep := range eps {
+		log.Printf("Server listening: %s\n", ep)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return run(ctx, o, eps...)
+}
+
+// endpoints opens the listeners in shutdown order. On failure the
+// listeners opened so far are closed again.
+func (s *Server) endpoints(o *options) (eps []endpoint, err error) {
+	if s.FCGIAddr == "" && s.HTTPAddr == "" && s.AdminAddr == "" {
+		return nil, errors.New("server: no listener address configured")
+	}
+
+	var lns []net.Listener
+	defer func() {
+		if err != nil {
+			for _, ln := range lns {
+				ln.Close()
+			}
+		}
+	}()
+	open := func(name, addr string) (net.Listener, error) {
+		ln, err := listen(addr, o.cfg.SocketMode)
+		if err != nil {
+			return nil, fmt.Errorf("net.Listen failed for %s=%s: %v", name, addr, err)
+		}
+		lns = append(lns, ln)
+		return ln, nil
+	}
+
+	if s.FCGIAddr != "" {
+		ln, err := open("FCGI_LISTEN", s.FCGIAddr)
+		if err != nil {
+			return nil, err
+		}
+		eps = append(eps, newFCGIEndpoint(ln, s.Handler, o.cfg))
+	}
+
+	if s.HTTPAddr != "" {
+		srv := newHTTPServer(s.HTTPAddr, s.Handler, o.cfg)
+		if s.TLSCertFile != "" || s.TLSKeyFile != "" {
+			if srv.TLSConfig, err = newTLSConfig(s.TLSCertFile, s.TLSKeyFile); err != nil {
+				return nil, err
+			}
+		}
+		ln, err := open("ADDR", s.HTTPAddr)
+		if err != nil {
+			return nil, err
+		}
+		eps = append(eps, newHTTPEndpoint(ln, srv))
+
+		if s.RedirectAddr != "" && srv.TLSConfig != nil {
+			rln, err := open("TLS_REDIRECT_ADDR", s.RedirectAddr)
+			if err != nil {
+				return nil, err
+			}
+			eps = append(eps, newHTTPEndpoint(rln, newHTTPServer(s.RedirectAddr, redirectHandler(s.HTTPAddr), o.cfg)))
+		}
+	}
+
+	if s.AdminAddr != "" {
+		h := s.AdminHandler
+		if h == nil {
+			h = NewAdminMux()
+		}
+		ln, err := open("ADMIN_ADDR", s.AdminAddr)
+		if err != nil {
+			return nil, err
+		}
+		eps = append(eps, newHTTPEndpoint(ln, newAdminServer(s.AdminAddr, h, o.cfg)))
+	}
+	return eps, nil
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// FastCGI, HTTP and admin listeners run side by side and stop together.
+func TestServerRunsAllListeners(t *testing.T) {
+	dir := t.TempDir()
+	s := &Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "public")
+		}),
+		FCGIAddr:  "unix:" + filepath.Join(dir, "fcgi.sock"),
+		HTTPAddr:  "unix:" + filepath.Join(dir, "http.sock"),
+		AdminAddr: "unix:" + filepath.Join(dir, "admin.sock"),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.ListenAndServe(ctx) }()
+	waitForSocket(t, filepath.Join(dir, "admin.sock"))
+
+	if got := getUnix(t, filepath.Join(dir, "http.sock"), "/"); got != "public" {
+		t.Errorf("http: want public, got %q", got)
+	}
+	if got := getUnix(t, filepath.Join(dir, "admin.sock"), "/debug/pprof/goroutine?debug=1"); !strings.Contains(got, "goroutine profile") {
+		t.Errorf("admin: want goroutine profile, got %q", got)
+	}
+	if got := getUnix(t, filepath.Join(dir, "admin.sock"), "/"); strings.Contains(got, "public") {
+		t.Error("admin listener must not serve the public handler")
+	}
+	if c, err := net.Dial("unix", filepath.Join(dir, "fcgi.sock")); err != nil {
+		t.Errorf("fcgi: %v", err)
+	} else {
+		c.Close()
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("want nil, got %v", err)
+	}
+	for _, sock := range []string{"fcgi.sock", "http.sock", "admin.sock"} {
+		if _, err := os.Stat(filepath.Join(dir, sock)); err == nil {
+			t.Errorf("%s still exists after shutdown", sock)
+		}
+	}
+}
+
+// The admin listener serves CPU profiles longer than the public
+// WriteTimeout.
+func TestAdminServerHasNoWriteTimeout(t *testing.T) {
+	cfg := newOptions(nil).cfg
+	if srv := newAdminServer(":0", NewAdminMux(), cfg); srv.WriteTimeout > 0 {
+		t.Errorf("admin WriteTimeout: want none, got %v", srv.WriteTimeout)
+	}
+	if cfg.WriteTimeout != DefaultWriteTimeout {
+		t.Errorf("public WriteTimeout changed to %v", cfg.WriteTimeout)
+	}
+}
+
+// A listener that cannot be opened fails the whole server and releases the
+// listeners opened before it.
+func TestServerListenFailureClosesOthers(t *testing.T) {
+	dir := t.TempDir()
+	s := &Server{
+		Handler:  http.NotFoundHandler(),
+		FCGIAddr: "unix:" + filepath.Join(dir, "fcgi.sock"),
+		HTTPAddr: "unix:" + filepath.Join(dir, "missing", "http.sock"),
+	}
+
+	err := s.ListenAndServe(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "ADDR=") {
+		t.Fatalf("want ADDR listen error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "fcgi.sock")); err == nil {
+		t.Fatal("fcgi socket left open after failed start")
+	}
+}
+
+func TestServerWithoutAddress(t *testing.T) {
+	if err := (&Server{}).ListenAndServe(context.Background()); err == nil {
+		t.Fatal("want error without any address")
+	}
+}
+
+func TestNewServerFromEnv(t *testing.T) {
+	for _, tc := range []struct {
+		name               string
+		env                map[string]string
+		wantFCGI, wantHTTP string
+		wantAdmin          string
+	}{
+		{"fcgi and http side by side",
+			map[string]string{"FCGI_LISTEN": "127.0.0.1:9001", "ADDR": "127.0.0.1:9002", "ADMIN_ADDR": "127.0.0.1:9003"},
+			"127.0.0.1:9001", "127.0.0.1:9002", "127.0.0.1:9003"},
+		{"PORT enables http", map[string]string{"PORT": "8080"}, "", ":8080", ""},
+		{"fcgi only", map[string]string{"FCGI_LISTEN": "unix:/run/app.sock"}, "unix:/run/app.sock", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, k := range []string{"FCGI_LISTEN", "ADDR", "PORT", "ADMIN_ADDR", "TLS_CERT_FILE", "TLS_KEY_FILE"} {
+				t.Setenv(k, tc.env[k])
+			}
+			s, err := NewServerFromEnv(http.NotFoundHandler())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.FCGIAddr != tc.wantFCGI || s.HTTPAddr != tc.wantHTTP || s.AdminAddr != tc.wantAdmin {
+				t.Fatalf("got fcgi=%q http=%q admin=%q", s.FCGIAddr, s.HTTPAddr, s.AdminAddr)
+			}
+		})
+	}
+}
+
+func waitForSocket(t *testing.T, path string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+	}
+	t.Fatalf("socket %s did not appear", path)
+}
+
+func getUnix(t *testing.T, sock, path string) string {
+	t.Helper()
+	c := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := c.Get("http://unix" + path)
+	if err != nil {
+		t.Fatalf("GET %s via %s: %v", path, sock, err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	return string(b)
+}
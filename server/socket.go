@@ -0,0 +1,168 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Address forms understood by [listen] besides a plain TCP host:port.
+const (
+	unixPrefix    = "unix:"
+	systemdPrefix = "systemd"
+	fdPrefix      = "fd:"
+)
+
+// listen opens the listener for addr:
+//
+//   - "unix:/path/to.sock" → unix socket; a stale socket file left behind
+//     by a crash is removed first, and mode (when non-zero) is applied to
+//     the socket file.
+//   - "systemd" or "systemd:<name>" → a socket passed by systemd socket
+//     activation (LISTEN_FDS/LISTEN_PID). The bare form takes the first
+//     socket; the named form matches FileDescriptorName= of the .socket
+//     unit.
+//   - "fd:<n>" → an inherited, already listening file descriptor.
+//   - anything else → TCP host:port.
+func listen(addr string, mode fs.FileMode) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(addr, unixPrefix):
+		return listenUnix(strings.TrimPrefix(addr, unixPrefix), mode)
+	case addr == systemdPrefix || strings.HasPrefix(addr, systemdPrefix+":"):
+		return activatedListener(strings.TrimPrefix(strings.TrimPrefix(addr, systemdPrefix), ":"))
+	case strings.HasPrefix(addr, fdPrefix):
+		fd, err := strconv.Atoi(strings.TrimPrefix(addr, fdPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid file descriptor in %q", addr)
+		}
+		return fileListener(fd, addr)
+	default:
+		return net.Listen("tcp", addr)
+	}
+}
+
+func listenUnix(path string, mode fs.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// fileListener turns an inherited, listening fd into a net.Listener and
+// takes ownership of fd: net.FileListener works on a dup, and fd itself is
+// closed. This is how sockets from systemd (sd_listen_fds) and a parent
+// process are meant to be used: they belong to this process alone, and
+// nothing else may close or reuse the number. Only fd 0 stays open.
+func fileListener(fd int, name string) (net.Listener, error) {
+	if fd == 0 {
+		// FastCGI on stdin, as fcgi.Serve(nil, …) does it. os.Stdin stays
+		// open; closing a second *os.File for fd 0 would pull it away.
+		return net.FileListener(os.Stdin)
+	}
+	f := os.NewFile(uintptr(fd), name)
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// Test seams for socket activation.
+var (
+	getpid         = os.Getpid
+	listenFdsStart = 3 // SD_LISTEN_FDS_START
+)
+
+// activation holds the sockets passed by systemd. They are collected once
+// per process, and each can be handed out only once.
+var activation struct {
+	once  sync.Once
+	mu    sync.Mutex
+	lns   []net.Listener
+	names []string
+	taken []bool
+	err   error
+}
+
+// systemdActivated reports whether systemd passed sockets to this process.
+func systemdActivated() bool {
+	return os.Getenv("LISTEN_FDS") != "" && os.Getenv("LISTEN_PID") == strconv.Itoa(getpid())
+}
+
+// activatedListener returns the socket called name, or the first one when
+// name is empty.
+func activatedListener(name string) (net.Listener, error) {
+	activation.once.Do(collectActivated)
+	activation.mu.Lock()
+	defer activation.mu.Unlock()
+	if activation.err != nil {
+		return nil, activation.err
+	}
+	for i, ln := range activation.lns {
+		if name != "" && activation.names[i] != name {
+			continue
+		}
+		if activation.taken[i] {
+			if name == "" {
+				continue
+			}
+			return nil, fmt.Errorf("systemd socket %q is already in use", name)
+		}
+		activation.taken[i] = true
+		return ln, nil
+	}
+	if name == "" {
+		return nil, errors.New("no systemd socket available (LISTEN_FDS/LISTEN_PID not set for this process)")
+	}
+	return nil, fmt.Errorf("no systemd socket named %q (LISTEN_FDNAMES=%q)", name, os.Getenv("LISTEN_FDNAMES"))
+}
+
+// collectActivated implements sd_listen_fds(unset_environment=1): the
+// variables are cleared so child processes do not pick up our sockets.
+func collectActivated() {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if !systemdActivated() {
+		return
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		activation.err = fmt.Errorf("invalid LISTEN_FDS=%q", os.Getenv("LISTEN_FDS"))
+		return
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < n; i++ {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		ln, err := fileListener(listenFdsStart+i, name)
+		if err != nil {
+			activation.err = fmt.Errorf("systemd socket %d (%q): %w", i, name, err)
+			return
+		}
+		activation.lns = append(activation.lns, ln)
+		activation.names = append(activation.names, name)
+		activation.taken = append(activation.taken, false)
+	}
+}
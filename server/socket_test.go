@@ -0,0 +1,97 @@
+package server
+
+import (
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "app.sock")
+
+	// A socket file left behind by a crashed process must not block startup.
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen("unix:"+sock, 0o600)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Type() != fs.ModeSocket || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("want socket with mode 0600, got %v", fi.Mode())
+	}
+	assertAccepts(t, ln, "unix", sock)
+}
+
+// A regular file at the socket path is never removed.
+func TestListenUnixKeepsRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	mustWrite(t, path, "precious")
+
+	if ln, err := listen("unix:"+path, 0); err == nil {
+		ln.Close()
+		t.Fatal("want error for a regular file at the socket path")
+	}
+	if b, _ := os.ReadFile(path); string(b) != "precious" {
+		t.Fatal("regular file was touched")
+	}
+}
+
+// LISTEN_PID for another process means the sockets are not ours.
+func TestListenSystemdWrongPID(t *testing.T) {
+	stubActivation(t, 3, 1, "")
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+
+	if systemdActivated() {
+		t.Fatal("want not activated for a foreign LISTEN_PID")
+	}
+	if _, err := listen("systemd", 0); err == nil {
+		t.Fatal("want error without activation")
+	}
+}
+
+func stubActivation(t *testing.T, start, n int, names string) {
+	t.Helper()
+	origStart := listenFdsStart
+	listenFdsStart = start
+	activation.once = sync.Once{}
+	activation.lns, activation.names, activation.taken, activation.err = nil, nil, nil, nil
+	t.Cleanup(func() {
+		listenFdsStart = origStart
+		activation.once = sync.Once{}
+		activation.lns, activation.names, activation.taken, activation.err = nil, nil, nil, nil
+	})
+	t.Setenv("ADDR", "")
+	t.Setenv("PORT", "")
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", strconv.Itoa(n))
+	t.Setenv("LISTEN_FDNAMES", names)
+}
+
+func assertAccepts(t *testing.T, ln net.Listener, network, addr string) {
+	t.Helper()
+	go func() {
+		if c, err := ln.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+	c, err := net.Dial(network, addr)
+	if err != nil {
+		t.Fatalf("dial %s: %v", addr, err)
+	}
+	c.Close()
+}
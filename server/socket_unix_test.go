@@ -0,0 +1,67 @@
+//go:build unix
+
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestListenInheritedFD(t *testing.T) {
+	tcp := mustListen(t)
+	defer tcp.Close()
+
+	ln, err := listen("fd:"+strconv.Itoa(inheritedFD(t, tcp)), 0)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	assertAccepts(t, ln, "tcp", tcp.Addr().String())
+}
+
+func TestListenSystemdActivation(t *testing.T) {
+	tcp := mustListen(t)
+	defer tcp.Close()
+	stubActivation(t, inheritedFD(t, tcp), 1, "web")
+
+	if got := listenAddr(); got != "systemd" {
+		t.Fatalf("listenAddr: want systemd when activated, got %q", got)
+	}
+
+	if _, err := listen("systemd:admin", 0); err == nil || !strings.Contains(err.Error(), `no systemd socket named "admin"`) {
+		t.Fatalf("want unknown-name error, got %v", err)
+	}
+	ln, err := listen("systemd:web", 0)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	assertAccepts(t, ln, "tcp", tcp.Addr().String())
+
+	if _, err := listen("systemd", 0); err == nil {
+		t.Fatal("want error once the only socket is in use")
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Fatal("LISTEN_FDS must be unset after collecting the sockets")
+	}
+}
+
+// inheritedFD returns a duplicate of the descriptor of ln, like one passed
+// by a parent process: owned by nobody but the listener made from it.
+func inheritedFD(t *testing.T, ln net.Listener) int {
+	t.Helper()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tlsFiles returns TLS_CERT_FILE and TLS_KEY_FILE. Setting only one of
+// them is a configuration error.
+func tlsFiles() (certFile, keyFile string, err error) {
+	certFile, keyFile = os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if (certFile == "") != (keyFile == "") {
+		return "", "", fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	return certFile, keyFile, nil
+}
+
+// newTLSConfig returns a server tls.Config that serves the certificate pair
+// through a [certReloader].
+func newTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cr.GetCertificate,
+	}, nil
+}
+
+// certCheckInterval throttles how often certReloader stats the files.
+// Test seam.
+var certCheckInterval = time.Second
+
+// certReloader serves a certificate pair from disk and reloads it when the
+// modification time or size of either file changes, so certbot & co. can
+// renew certificates without a restart. A pair that fails to load (e.g.
+// the renewal is only half written) is logged and the previous
+// certificate stays in use.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	stamp     string
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastCheck) >= certCheckInterval {
+		if err := r.reload(); err != nil {
+			log.Printf("config-mate: keeping previous TLS certificate: %v", err)
+		}
+	}
+	return r.cert, nil
+}
+
+// reload loads the pair if the files changed since the last load. Callers
+// hold r.mu (or own r exclusively).
+func (r *certReloader) reload() error {
+	r.lastCheck = time.Now()
+	stamp, err := fileStamp(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	if r.cert != nil && stamp == r.stamp {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load TLS certificate %s: %w", r.certFile, err)
+	}
+	r.cert, r.stamp = &cert, stamp
+	return nil
+}
+
+// fileStamp summarises modification time and size of the given files.
+func fileStamp(paths ...string) (string, error) {
+	var s string
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return "", err
+		}
+		s += fmt.Sprintf("%s:%d:%d;", p, fi.ModTime().UnixNano(), fi.Size())
+	}
+	return s, nil
+}
+
+// redirectHandler sends every request to the HTTPS listener on httpsAddr,
+// keeping host, path and query. 308 preserves the method and body.
+func redirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		switch {
+		case port != "" && port != "443":
+			host = net.JoinHostPort(host, port)
+		case strings.Contains(host, ":"):
+			host = "[" + host + "]" // IPv6 literal
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
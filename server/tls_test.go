@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLSFiles(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "cert.pem")
+	t.Setenv("TLS_KEY_FILE", "")
+	if _, _, err := tlsFiles(); err == nil {
+		t.Fatal("want error when only TLS_CERT_FILE is set")
+	}
+
+	t.Setenv("TLS_KEY_FILE", "key.pem")
+	cert, key, err := tlsFiles()
+	if err != nil || cert != "cert.pem" || key != "key.pem" {
+		t.Fatalf("got (%q, %q, %v)", cert, key, err)
+	}
+}
+
+// The HTTPS endpoint serves the certificate on disk and picks up a renewed
+// pair without a restart.
+func TestHTTPSEndpointReloadsCertificate(t *testing.T) {
+	orig := certCheckInterval
+	certCheckInterval = 0
+	t.Cleanup(func() { certCheckInterval = orig })
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSignedCert(t, certFile, keyFile, "first")
+
+	ln := mustListen(t)
+	srv := newHTTPServer("", http.NotFoundHandler(), newOptions(nil).cfg)
+	var err error
+	if srv.TLSConfig, err = newTLSConfig(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- run(ctx, newOptions(nil), newHTTPEndpoint(ln, srv)) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("run: %v", err)
+		}
+	})
+
+	if got := servedCommonName(t, ln.Addr().String()); got != "first" {
+		t.Fatalf("want CN first, got %q", got)
+	}
+
+	writeSelfSignedCert(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := servedCommonName(t, ln.Addr().String()); got != "second" {
+		t.Fatalf("want CN second after renewal, got %q", got)
+	}
+}
+
+// A broken renewal keeps the previous certificate in service.
+func TestCertReloaderKeepsPreviousOnError(t *testing.T) {
+	orig := certCheckInterval
+	certCheckInterval = 0
+	t.Cleanup(func() { certCheckInterval = orig })
+	origLog := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(origLog) })
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSignedCert(t, certFile, keyFile, "first")
+	cr, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, certFile, "not a certificate")
+
+	cert, err := cr.GetCertificate(nil)
+	if err != nil || cert == nil || cert.Leaf.Subject.CommonName != "first" {
+		t.Fatalf("want previous certificate, got (%v, %v)", cert, err)
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	for _, tc := range []struct {
+		httpsAddr, url, want string
+	}{
+		{":443", "http://example.com/a?b=c", "https://example.com/a?b=c"},
+		{":8443", "http://example.com:8080/a", "https://example.com:8443/a"},
+		{"127.0.0.1:8443", "http://[::1]:8080/", "https://[::1]:8443/"},
+		{":443", "http://[::1]/p", "https://[::1]/p"},
+		{":443", "http://[::1]:80/p", "https://[::1]/p"},
+	} {
+		rec := httptest.NewRecorder()
+		redirectHandler(tc.httpsAddr).ServeHTTP(rec, httptest.NewRequest("POST", tc.url, nil))
+		if rec.Code != http.StatusPermanentRedirect {
+			t.Errorf("%s: want 308, got %d", tc.url, rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != tc.want {
+			t.Errorf("%s: want %s, got %s", tc.url, tc.want, got)
+		}
+	}
+}
+
+func servedCommonName(t *testing.T, addr string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func writeSelfSignedCert(t *testing.T, certFile, keyFile, cn string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, certFile, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	mustWrite(t, keyFile, string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+}
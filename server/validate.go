@@ -0,0 +1,287 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldError is a failed check of one config key.
+type FieldError struct {
+	Key string // dotted key path, e.g. database.dsn or servers[1].addr
+	Msg string
+}
+
+func (e FieldError) Error() string {
+	if e.Key == "" {
+		return e.Msg
+	}
+	return e.Key + ": " + e.Msg
+}
+
+// ValidationError lists every failed check of a config.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+// ValidateConfig checks a decoded config and reports every failure in one
+// [*ValidationError]. [ReadInConfig] and [WatchConfig] call it after
+// decoding.
+//
+// Fields are checked against their `validate:"…"` tag, a comma-separated
+// list of rules:
+//
+//   - required: not the zero value
+//   - min=N, max=N: bounds of a number or duration (e.g. min=1s), or of the
+//     length of a string, slice or map
+//   - oneof=a b c: one of the space-separated values
+//   - url: an absolute URL with scheme and host
+//   - hostport: host:port, as accepted by net.SplitHostPort
+//   - file-exists: names an existing regular file
+//   - dir-writable: names a directory this process can create files in
+//
+// Rules other than required, min and max accept an empty value; combine
+// them with required where needed. Then every struct, including nested
+// structs and the elements of slices and maps, whose pointer implements
+// Validate() error is asked to validate itself.
+//
+// [ReadInConfig] treats required on a config key like `required:"true"`:
+// it is reported in a [*MissingConfigError] with the env var to set, not
+// here. Within the elements of slices and maps it is checked here.
+func ValidateConfig(cfg any) error {
+	return validateConfig(cfg, false)
+}
+
+// validateConfig is ValidateConfig; with keysRequired the required rule of
+// config keys is left to checkRequired.
+func validateConfig(cfg any, keysRequired bool) error {
+	var errs []FieldError
+	validateValue(reflect.ValueOf(cfg), "", keysRequired, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: errs}
+}
+
+type validator interface {
+	Validate() error
+}
+
+// validateValue checks v at key; skipRequired leaves out the required rule
+// while v is reached through struct fields only, i.e. is a config key.
+func validateValue(v reflect.Value, key string, skipRequired bool, errs *[]FieldError) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if !isConfigStruct(v.Type()) {
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			name, squash, ok := configFieldName(f)
+			if !ok {
+				continue
+			}
+			fkey := key
+			if !squash {
+				fkey = joinKey(key, name)
+			}
+			if tag, ok := f.Tag.Lookup("validate"); ok {
+				checkRules(v.Field(i), fkey, tag, skipRequired, errs)
+			}
+			validateValue(v.Field(i), fkey, skipRequired, errs)
+		}
+		if !v.CanAddr() {
+			// Unaddressable copies (map values) cannot use pointer methods.
+			cp := reflect.New(v.Type())
+			cp.Elem().Set(v)
+			v = cp.Elem()
+		}
+		if val, ok := v.Addr().Interface().(validator); ok {
+			appendValidateErr(val.Validate(), key, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			validateValue(v.Index(i), fmt.Sprintf("%s[%d]", key, i), false, errs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateValue(iter.Value(), joinKey(key, fmt.Sprint(iter.Key().Interface())), false, errs)
+		}
+	}
+}
+
+// appendValidateErr adds the error of a Validate method at key; a nested
+// *ValidationError keeps its field keys below key.
+func appendValidateErr(err error, key string, errs *[]FieldError) {
+	if err == nil {
+		return
+	}
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		for _, f := range ve.Fields {
+			*errs = append(*errs, FieldError{Key: joinKey(key, f.Key), Msg: f.Msg})
+		}
+		return
+	}
+	*errs = append(*errs, FieldError{Key: key, Msg: err.Error()})
+}
+
+// hasRule reports whether the validate tag holds the rule name.
+func hasRule(tag, name string) bool {
+	for _, rule := range strings.Split(tag, ",") {
+		if n, _, _ := strings.Cut(strings.TrimSpace(rule), "="); n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func joinKey(prefix, name string) string {
+	switch {
+	case prefix == "":
+		return name
+	case name == "":
+		return prefix
+	default:
+		return prefix + "." + name
+	}
+}
+
+func checkRules(v reflect.Value, key, tag string, skipRequired bool, errs *[]FieldError) {
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "" || name == "required" && skipRequired {
+			continue
+		}
+		if msg := checkRule(v, name, arg); msg != "" {
+			*errs = append(*errs, FieldError{Key: key, Msg: msg})
+		}
+	}
+}
+
+// checkRule returns why v fails rule name=arg, or "".
+func checkRule(v reflect.Value, name, arg string) string {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			if name == "required" {
+				return "required"
+			}
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch name {
+	case "required":
+		if v.IsZero() {
+			return "required"
+		}
+		return ""
+	case "min", "max":
+		return checkBound(v, name, arg)
+	}
+
+	if v.IsZero() {
+		return ""
+	}
+	s := fmt.Sprint(v.Interface())
+	switch name {
+	case "oneof":
+		for _, want := range strings.Fields(arg) {
+			if s == want {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s, got %q", strings.Join(strings.Fields(arg), ", "), s)
+	case "url":
+		if u, err := url.Parse(s); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Sprintf("must be an absolute URL, got %q", s)
+		}
+	case "hostport":
+		if _, port, err := net.SplitHostPort(s); err != nil || port == "" {
+			return fmt.Sprintf("must be host:port, got %q", s)
+		}
+	case "file-exists":
+		fi, err := os.Stat(s)
+		if err != nil {
+			return fmt.Sprintf("file %s does not exist", s)
+		}
+		if !fi.Mode().IsRegular() {
+			return fmt.Sprintf("%s is not a regular file", s)
+		}
+	case "dir-writable":
+		f, err := os.CreateTemp(s, ".config-mate-*")
+		if err != nil {
+			return fmt.Sprintf("directory %s is not writable", s)
+		}
+		f.Close()
+		os.Remove(f.Name())
+	default:
+		return fmt.Sprintf("unknown validate rule %q", name)
+	}
+	return ""
+}
+
+var (
+	durationType = reflect.TypeFor[time.Duration]()
+	stringType   = reflect.TypeFor[string]()
+)
+
+func checkBound(v reflect.Value, name, arg string) string {
+	var got, bound float64
+	var err error
+	show := arg
+	switch {
+	case v.Type() == durationType:
+		var d time.Duration
+		d, err = time.ParseDuration(arg)
+		got, bound = float64(v.Int()), float64(d)
+	case v.CanInt():
+		got = float64(v.Int())
+		bound, err = strconv.ParseFloat(arg, 64)
+	case v.CanUint():
+		got = float64(v.Uint())
+		bound, err = strconv.ParseFloat(arg, 64)
+	case v.CanFloat():
+		got = v.Float()
+		bound, err = strconv.ParseFloat(arg, 64)
+	case v.Kind() == reflect.String || v.Kind() == reflect.Slice || v.Kind() == reflect.Map || v.Kind() == reflect.Array:
+		got = float64(v.Len())
+		bound, err = strconv.ParseFloat(arg, 64)
+		show = arg + " long"
+	default:
+		return fmt.Sprintf("%s does not apply to %s", name, v.Type())
+	}
+	if err != nil {
+		return fmt.Sprintf("invalid %s=%s", name, arg)
+	}
+	if name == "min" && got < bound {
+		return "must be at least " + show
+	}
+	if name == "max" && got > bound {
+		return "must be at most " + show
+	}
+	return ""
+}
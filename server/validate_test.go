@@ -0,0 +1,129 @@
+package server
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type validatedServer struct {
+	Addr string `validate:"required,hostport"`
+}
+
+func (s validatedServer) Validate() error {
+	if strings.HasPrefix(s.Addr, "0.0.0.0:") {
+		return errors.New("must not bind all interfaces")
+	}
+	return nil
+}
+
+type validatedConfig struct {
+	Database struct {
+		DSN  string `mapstructure:"dsn" validate:"required"`
+		Type string `validate:"oneof=sqlite mysql"`
+	}
+	Port     int               `validate:"min=1,max=65535"`
+	Timeout  time.Duration     `validate:"min=1s"`
+	Name     string            `validate:"max=3"`
+	Callback string            `validate:"url"`
+	CertFile string            `mapstructure:"cert_file" validate:"file-exists"`
+	DataDir  string            `mapstructure:"data_dir" validate:"dir-writable"`
+	Servers  []validatedServer `validate:"min=1"`
+	Optional string            `validate:"url"`
+}
+
+func (c *validatedConfig) Validate() error {
+	if c.Database.Type == "mysql" && c.Port == 3306 {
+		return &ValidationError{Fields: []FieldError{{Key: "port", Msg: "clashes with mysql"}}}
+	}
+	return nil
+}
+
+func TestValidateConfig(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	mustWrite(t, cert, "x")
+
+	valid := validatedConfig{Port: 8080, Timeout: time.Second, Name: "abc", Callback: "https://example.com/cb",
+		CertFile: cert, DataDir: dir, Servers: []validatedServer{{Addr: "127.0.0.1:80"}}}
+	valid.Database.DSN, valid.Database.Type = "file:app.db", "sqlite"
+	if err := ValidateConfig(&valid); err != nil {
+		t.Fatalf("want valid, got %v", err)
+	}
+
+	invalid := validatedConfig{Port: 3306, Timeout: time.Millisecond, Name: "abcd", Callback: "/cb",
+		CertFile: dir, DataDir: filepath.Join(dir, "missing"),
+		Servers: []validatedServer{{Addr: "127.0.0.1:80"}, {Addr: "localhost"}, {Addr: "0.0.0.0:80"}}}
+	invalid.Database.Type = "mysql"
+	err := ValidateConfig(&invalid)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("want ValidationError, got %v", err)
+	}
+	want := []string{
+		"database.dsn: required",
+		"timeout: must be at least 1s",
+		"name: must be at most 3 long",
+		`callback: must be an absolute URL, got "/cb"`,
+		"cert_file: " + dir + " is not a regular file",
+		"data_dir: directory " + filepath.Join(dir, "missing") + " is not writable",
+		`servers[1].addr: must be host:port, got "localhost"`,
+		"servers[2]: must not bind all interfaces",
+		"port: clashes with mysql",
+	}
+	if len(ve.Fields) != len(want) {
+		t.Errorf("want %d errors, got %v", len(want), ve.Fields)
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("want %q in %v", w, err)
+		}
+	}
+}
+
+// ReadInConfig reports validation failures of the decoded file.
+func TestReadInConfig_Validates(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("CONFIG_BASE_PATH", "")
+	t.Setenv("HOME", home)
+	mustWrite(t, filepath.Join(home, ".config", "myapp.yaml"), "port: 70000\n")
+
+	var cfg struct {
+		Port int `validate:"max=65535"`
+	}
+	err := ReadInConfig(&cfg)
+	if err == nil || !strings.Contains(err.Error(), "port: must be at most 65535") {
+		t.Fatalf("want port error, got %v", err)
+	}
+}
+
+// On a config key, validate:"required" is the same as required:"true":
+// ReadInConfig reports it once, in a MissingConfigError. Within list
+// elements it is a validation failure.
+func TestReadInConfig_ValidateRequired(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("CONFIG_BASE_PATH", "")
+	t.Setenv("HOME", home)
+	mustWrite(t, filepath.Join(home, ".config", "myapp.yaml"), "servers:\n  - addr: ''\n")
+
+	var cfg struct {
+		DSN     string            `mapstructure:"dsn" validate:"required"`
+		APIKey  string            `mapstructure:"api_key" required:"true"`
+		Servers []validatedServer `mapstructure:"servers"`
+	}
+	err := ReadInConfig(&cfg)
+	var missing *MissingConfigError
+	if !errors.As(err, &missing) || strings.Join(missing.Keys, ",") != "dsn,api_key" {
+		t.Fatalf("want dsn and api_key missing, got %v", err)
+	}
+	var ve *ValidationError
+	if !errors.As(err, &ve) || len(ve.Fields) != 1 || ve.Fields[0].Key != "servers[0].addr" {
+		t.Fatalf("want only servers[0].addr invalid, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mitchellh/mapstructure"
+)
+
+// configReloadDelay collects the burst of events an editor or deploy
+// produces when saving a file into a single reload.
+var configReloadDelay = 100 * time.Millisecond
+
+// ConfigWatcher holds the current config of type T and reloads it when one
+// of its files changes. See [WatchConfig].
+type ConfigWatcher[T any] struct {
+	loader  *configLoader
+	current atomic.Pointer[T]
+
+	mu   sync.Mutex
+	subs []func(prev, next *T)
+
+	fsw       *fsnotify.Watcher
+	timer     *time.Timer
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+	wg        sync.WaitGroup
+}
+
+// WatchConfig reads the config like [ReadInConfig] into a new T and then
+// watches the locations it was read from. When a config file is written,
+// added or removed, including drop-in files, all files are merged and
+// decoded again into a fresh T with the same decode hooks; when the result
+// is valid (see [ValidateConfig]) it replaces the current value and the
+// subscribers registered with [ConfigWatcher.OnChange] are called. An
+// invalid or unreadable file is logged and the current value is kept, so a
+// typo never takes the service down.
+//
+// The initial config must be valid. Without a config file there is nothing
+// to watch and Load always returns the initial value. Call Close to stop
+// watching.
+func WatchConfig[T any](fs ...mapstructure.DecodeHookFunc) (*ConfigWatcher[T], error) {
+	l, err := newConfigLoader(fs, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := l.read(); err != nil {
+		return nil, err
+	}
+	cfg, err := decodeConfig[T](l)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &ConfigWatcher[T]{loader: l, done: make(chan struct{})}
+	w.current.Store(cfg)
+
+	if len(l.files) > 0 {
+		if w.fsw, err = fsnotify.NewWatcher(); err != nil {
+			return nil, fmt.Errorf("cannot watch config: %w", err)
+		}
+		// Watch the directories: editors and deploy tools replace files by
+		// renaming, which ends a watch on the file itself.
+		for _, dir := range l.watchDirs() {
+			if err := w.fsw.Add(dir); err != nil {
+				w.fsw.Close()
+				return nil, fmt.Errorf("cannot watch config: %w", err)
+			}
+		}
+		w.wg.Add(1)
+		go w.watch()
+	}
+	return w, nil
+}
+
+func decodeConfig[T any](l *configLoader) (*T, error) {
+	cfg := new(T)
+	if err := l.decode(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Load returns the current config. It is safe for concurrent use; treat
+// the result as read-only.
+func (w *ConfigWatcher[T]) Load() *T {
+	return w.current.Load()
+}
+
+// OnChange registers fn to be called with the previous and the new config
+// after every successful reload. Calls happen one at a time on the
+// watcher's goroutine.
+func (w *ConfigWatcher[T]) OnChange(fn func(prev, next *T)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.subs = append(w.subs, fn)
+}
+
+// Close stops watching. Load keeps returning the last config.
+func (w *ConfigWatcher[T]) Close() error {
+	if w.fsw == nil {
+		return nil
+	}
+	w.closeOnce.Do(func() {
+		close(w.done)
+		w.closeErr = w.fsw.Close()
+		w.wg.Wait()
+	})
+	return w.closeErr
+}
+
+func (w *ConfigWatcher[T]) watch() {
+	defer w.wg.Done()
+	reload := make(chan struct{}, 1)
+	for {
+		select {
+		case <-w.done:
+			if w.timer != nil {
+				w.timer.Stop()
+			}
+			return
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			if ev.Has(fsnotify.Create) && w.loader.isDropInDir(ev.Name) {
+				// A drop-in directory created later: watch it, and reload
+				// when it was moved in with files.
+				if err := w.fsw.Add(ev.Name); err != nil {
+					log.Printf("config-mate: cannot watch %s: %v", ev.Name, err)
+				}
+				if len(dropInFiles(ev.Name)) == 0 {
+					continue
+				}
+			} else if !w.loader.isConfigFile(ev.Name) || !ev.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) {
+				continue
+			}
+			if w.timer == nil {
+				w.timer = time.AfterFunc(configReloadDelay, func() {
+					select {
+					case reload <- struct{}{}:
+					default:
+					}
+				})
+			} else {
+				w.timer.Reset(configReloadDelay)
+			}
+		case <-reload:
+			w.reload()
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("config-mate: config watch error: %v", err)
+		}
+	}
+}
+
+func (w *ConfigWatcher[T]) reload() {
+	if err := w.loader.read(); err != nil {
+		log.Printf("config-mate: keeping previous config: %v", err)
+		return
+	}
+	next, err := decodeConfig[T](w.loader)
+	if err != nil {
+		log.Printf("config-mate: keeping previous config: %v", err)
+		return
+	}
+	prev := w.current.Swap(next)
+
+	w.mu.Lock()
+	subs := append([]func(prev, next *T){}, w.subs...)
+	w.mu.Unlock()
+	for _, fn := range subs {
+		fn(prev, next)
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type watchedConfig struct {
+	Feature bool
+	Limit   int
+}
+
+func (c *watchedConfig) Validate() error {
+	if c.Limit < 0 {
+		return errors.New("limit must not be negative")
+	}
+	return nil
+}
+
+func TestWatchConfig(t *testing.T) {
+	file := setupWatchTest(t, "feature: false\nlimit: 1\n")
+
+	w, err := WatchConfig[watchedConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if got := w.Load(); got.Feature || got.Limit != 1 {
+		t.Fatalf("initial config: got %+v", got)
+	}
+
+	changes := make(chan [2]watchedConfig, 4)
+	w.OnChange(func(prev, next *watchedConfig) { changes <- [2]watchedConfig{*prev, *next} })
+
+	// An invalid file is ignored.
+	mustWrite(t, file, "feature: true\nlimit: -1\n")
+	expectNoChange(t, changes)
+	if w.Load().Feature {
+		t.Fatal("invalid config must not be applied")
+	}
+
+	// A file replaced by rename, as editors do, is picked up.
+	tmp := file + ".tmp"
+	mustWrite(t, tmp, "feature: true\nlimit: 2\n")
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-changes:
+		if c[0].Feature || !c[1].Feature || c[1].Limit != 2 {
+			t.Fatalf("got change %+v", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification")
+	}
+	if got := w.Load(); !got.Feature || got.Limit != 2 {
+		t.Fatalf("Load after reload: got %+v", got)
+	}
+
+	// Nothing is delivered after Close.
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, file, "feature: false\n")
+	expectNoChange(t, changes)
+}
+
+func TestWatchConfigRejectsInvalidInitialConfig(t *testing.T) {
+	setupWatchTest(t, "limit: -1\n")
+	if _, err := WatchConfig[watchedConfig](); err == nil {
+		t.Fatal("want error for an invalid initial config")
+	}
+}
+
+func TestWatchConfigWithoutFile(t *testing.T) {
+	setupWatchTest(t, "")
+	w, err := WatchConfig[watchedConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Load() == nil {
+		t.Fatal("want zero config")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Adding and removing a drop-in file, also in a drop-in directory created
+// after the watch started, reloads the config.
+func TestWatchConfigDropIns(t *testing.T) {
+	file := setupWatchTest(t, "limit: 1\n")
+	w, err := WatchConfig[watchedConfig]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	changes := make(chan [2]watchedConfig, 4)
+	w.OnChange(func(prev, next *watchedConfig) { changes <- [2]watchedConfig{*prev, *next} })
+
+	dropIn := filepath.Join(filepath.Dir(file), "myapp.d", "feature.yaml")
+	if err := os.Mkdir(filepath.Dir(dropIn), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // let the watcher add the new directory
+	mustWrite(t, dropIn, "feature: true\n")
+	if c := expectChange(t, changes); !c[1].Feature || c[1].Limit != 1 {
+		t.Fatalf("after adding drop-in: got %+v", c[1])
+	}
+
+	if err := os.Remove(dropIn); err != nil {
+		t.Fatal(err)
+	}
+	if c := expectChange(t, changes); c[1].Feature {
+		t.Fatalf("after removing drop-in: got %+v", c[1])
+	}
+}
+
+// setupWatchTest writes content (unless empty) as the XDG config file of
+// myapp and returns its path.
+func setupWatchTest(t *testing.T, content string) string {
+	t.Helper()
+	withStubbedHostsharing(t, func() (string, error) { return "", nil })
+	home := t.TempDir()
+	t.Setenv("SERVICE_NAME", "myapp")
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "xdg"))
+	t.Setenv("CONFIG_BASE_PATH", "")
+	t.Setenv("HOME", home)
+
+	orig := configReloadDelay
+	configReloadDelay = 10 * time.Millisecond
+	t.Cleanup(func() { configReloadDelay = orig })
+
+	file := filepath.Join(home, "xdg", "myapp.yaml")
+	if content != "" {
+		mustWrite(t, file, content)
+	}
+	return file
+}
+
+func expectChange(t *testing.T, changes <-chan [2]watchedConfig) [2]watchedConfig {
+	t.Helper()
+	select {
+	case c := <-changes:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change notification")
+		return [2]watchedConfig{}
+	}
+}
+
+func expectNoChange(t *testing.T, changes <-chan [2]watchedConfig) {
+	t.Helper()
+	select {
+	case c := <-changes:
+		t.Fatalf("unexpected change %+v", c)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,75 @@
+package tracing
+
+import (
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// InstrumentDB registers gorm callbacks on db (e.g. from database.Open)
+// that wrap every operation (create, query, update, delete, row, raw) in a
+// client span named "<operation> <table>", with the SQL statement (values
+// as placeholders) and the error, if any. gorm.ErrRecordNotFound is not an
+// error. The span is a child of the statement's context, so run queries
+// with db.WithContext(ctx).
+func InstrumentDB(db *gorm.DB) error {
+	tracer := otel.Tracer(instrumentationName)
+	system := db.Dialector.Name()
+
+	before := func(op string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			name, attrs := op, []attribute.KeyValue{
+				semconv.DBSystemNameKey.String(system),
+				semconv.DBOperationName(op),
+			}
+			if table := tx.Statement.Table; table != "" {
+				name += " " + table
+				attrs = append(attrs, semconv.DBCollectionName(table))
+			}
+			_, span := tracer.Start(tx.Statement.Context, name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...),
+			)
+			tx.InstanceSet(gormSpanKey, span)
+		}
+	}
+	after := func(tx *gorm.DB) {
+		v, ok := tx.InstanceGet(gormSpanKey)
+		span, _ := v.(trace.Span)
+		if !ok || span == nil {
+			return
+		}
+		defer span.End()
+
+		if sql := tx.Statement.SQL.String(); sql != "" {
+			span.SetAttributes(semconv.DBQueryText(sql))
+		}
+		if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+			span.RecordError(tx.Error)
+			span.SetStatus(codes.Error, tx.Error.Error())
+		}
+	}
+
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tracing:before_create", before("create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", after),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", before("query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", after),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", before("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", after),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", before("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", after),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", before("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", after),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", before("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", after),
+	)
+}
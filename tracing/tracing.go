@@ -0,0 +1,140 @@
+// Package tracing adds OpenTelemetry tracing: a server span per request
+// named after its chi route, W3C traceparent propagation in and out, and
+// spans for gorm queries. Records written through server.RequestLogger and
+// server.Logger carry the trace and span ID of their context.
+//
+// Wire it up at startup:
+//
+//	shutdown, err := tracing.Setup(ctx)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer shutdown(context.Background())
+//
+//	router.Use(tracing.Middleware(), server.RequestLogger())
+//	if err := tracing.InstrumentDB(db); err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// Middleware must run before server.RequestLogger so the request log line
+// is correlated too. Query spans join the request span only when the query
+// runs with the request context, e.g. database.Get(ctx).WithContext(ctx).
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sebatec-eu/config-mate/v2/core"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+const instrumentationName = "github.com/sebatec-eu/config-mate/v2/tracing"
+
+// Option configures [Setup].
+type Option func(*options)
+
+type options struct {
+	exporter sdktrace.SpanExporter
+}
+
+// WithExporter exports spans to exp instead of the exporter selected by
+// OTEL_TRACES_EXPORTER, e.g. tracetest.NewInMemoryExporter in tests.
+func WithExporter(exp sdktrace.SpanExporter) Option {
+	return func(o *options) {
+		o.exporter = exp
+	}
+}
+
+// Setup installs a global tracer provider for the service named by
+// core.ServiceName, in version core.BuildInfo().Version, and the W3C trace
+// context and baggage propagators. The returned function flushes pending
+// spans and shuts the provider down; call it before exiting.
+//
+// The exporter is chosen by OTEL_TRACES_EXPORTER:
+//
+//   - otlp: OTLP over HTTP, configured by the standard OTEL_EXPORTER_OTLP_*
+//     variables (endpoint, headers, timeout, …)
+//   - stdout: pretty-printed JSON on stdout, for local development
+//   - none: no export; trace IDs are still generated and propagated, so
+//     logs stay correlated with upstream services
+//
+// Unset, it is otlp when OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set and none otherwise. Sampling
+// follows OTEL_TRACES_SAMPLER and defaults to parent-based always-on.
+func Setup(ctx context.Context, opts ...Option) (func(context.Context) error, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	serviceName, err := core.ServiceName()
+	if err != nil {
+		return nil, fmt.Errorf("cannot detect environment: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(core.BuildInfo().Version),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build trace resource: %w", err)
+	}
+
+	exp := o.exporter
+	if exp == nil {
+		if exp, err = envExporter(ctx); err != nil {
+			return nil, err
+		}
+	}
+	tpOpts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if exp != nil {
+		tpOpts = append(tpOpts, sdktrace.WithBatcher(exp))
+	}
+	tp := sdktrace.NewTracerProvider(tpOpts...)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	return tp.Shutdown, nil
+}
+
+// envExporter returns the exporter selected by OTEL_TRACES_EXPORTER, or
+// nil for none.
+func envExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	name := strings.ToLower(os.Getenv("OTEL_TRACES_EXPORTER"))
+	if name == "" && (os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "") {
+		name = "otlp"
+	}
+	switch name {
+	case "", "none":
+		return nil, nil
+	case "otlp":
+		exp, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create OTLP exporter: %w", err)
+		}
+		return exp, nil
+	case "stdout":
+		exp, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("cannot create stdout exporter: %w", err)
+		}
+		return exp, nil
+	default:
+		return nil, fmt.Errorf("unknown OTEL_TRACES_EXPORTER %q (want otlp, stdout or none)", name)
+	}
+}
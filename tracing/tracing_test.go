@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const parentTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// setup installs a provider exporting to memory; flush hands out the spans
+// ended so far.
+func setup(t *testing.T) (flush func() tracetest.SpanStubs) {
+	t.Helper()
+	t.Setenv("SERVICE_NAME", "myapp")
+	exp := tracetest.NewInMemoryExporter()
+	shutdown, err := Setup(context.Background(), WithExporter(exp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { shutdown(context.Background()) })
+	return func() tracetest.SpanStubs {
+		// Shutdown would reset the in-memory exporter.
+		otel.GetTracerProvider().(*sdktrace.TracerProvider).ForceFlush(context.Background())
+		return exp.GetSpans()
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	flush := setup(t)
+
+	var handlerSpan trace.SpanContext
+	r := chi.NewRouter()
+	r.Use(Middleware())
+	r.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	req := httptest.NewRequest("GET", "/items/42", nil)
+	req.Header.Set("traceparent", parentTraceparent)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := flush()
+	if len(spans) != 1 {
+		t.Fatalf("want 1 span, got %d", len(spans))
+	}
+	s := spans[0]
+	if s.Name != "GET /items/{id}" || s.SpanKind != trace.SpanKindServer {
+		t.Errorf("want server span GET /items/{id}, got %s %s", s.SpanKind, s.Name)
+	}
+	if s.Parent.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || s.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span does not continue the incoming trace: parent %v", s.Parent)
+	}
+	if handlerSpan.SpanID() != s.SpanContext.SpanID() {
+		t.Error("handler context does not carry the request span")
+	}
+	if s.Status.Code != codes.Error {
+		t.Errorf("want error status for 502, got %v", s.Status)
+	}
+	if s.Resource.String() == "" {
+		t.Error("want a service resource")
+	}
+}
+
+func TestTransportInjectsTraceparent(t *testing.T) {
+	flush := setup(t)
+
+	var got string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	req, _ := http.NewRequestWithContext(ctx, "GET", upstream.URL, nil)
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	traceID := parent.SpanContext().TraceID().String()
+	if !strings.HasPrefix(got, "00-"+traceID+"-") {
+		t.Fatalf("want traceparent of trace %s, got %q", traceID, got)
+	}
+	var client bool
+	for _, s := range flush() {
+		client = client || s.SpanKind == trace.SpanKindClient && strings.Contains(got, s.SpanContext.SpanID().String())
+	}
+	if !client {
+		t.Fatal("traceparent does not name the client span")
+	}
+}
+
+func TestInstrumentDB(t *testing.T) {
+	flush := setup(t)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InstrumentDB(db); err != nil {
+		t.Fatal(err)
+	}
+	type item struct{ ID int }
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&item{ID: 1})
+	db.Find(&[]item{})
+	db.Table("missing").Find(&[]item{})
+
+	want := map[string]bool{"create items": false, "query items": false, "query missing": false}
+	for _, s := range flush() {
+		if _, ok := want[s.Name]; !ok {
+			continue
+		}
+		want[s.Name] = true
+		if s.Name == "query missing" && s.Status.Code != codes.Error {
+			t.Errorf("want error status for a missing table, got %v", s.Status)
+		}
+	}
+	for name, seen := range want {
+		if !seen {
+			t.Errorf("no %q span", name)
+		}
+	}
+}